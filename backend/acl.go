@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DestinationACL 目标地址访问控制，防止通过代理池访问内网 (SSRF)
+type DestinationACL struct {
+	Enabled      bool     `json:"enabled"`
+	DefaultDeny  bool     `json:"default_deny"`
+	AllowCIDRs   []string `json:"allow_cidrs"`
+	DenyCIDRs    []string `json:"deny_cidrs"`
+	AllowDomains []string `json:"allow_domains"`
+	DenyDomains  []string `json:"deny_domains"`
+	AllowPorts   []int    `json:"allow_ports"`
+	DenyPorts    []int    `json:"deny_ports"`
+}
+
+var errDestinationDenied = errors.New("destination denied by ACL")
+
+var (
+	localAddrsOnce sync.Once
+	localAddrs     []*net.IPNet
+)
+
+// validate 检查 ACL 中的 CIDR 和端口是否合法
+func (a *DestinationACL) validate() error {
+	if _, err := parseCIDRList(a.AllowCIDRs); err != nil {
+		return err
+	}
+	if _, err := parseCIDRList(a.DenyCIDRs); err != nil {
+		return err
+	}
+	for _, port := range append(append([]int{}, a.AllowPorts...), a.DenyPorts...) {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+	}
+	return nil
+}
+
+// Check 在 DNS 解析之后判断目标是否允许访问
+func (a *DestinationACL) Check(ctx context.Context, host string, port int) error {
+	if !a.Enabled {
+		return nil
+	}
+
+	if len(a.AllowPorts) > 0 && !containsInt(a.AllowPorts, port) {
+		return fmt.Errorf("%w: port %d not allowed", errDestinationDenied, port)
+	}
+	if containsInt(a.DenyPorts, port) {
+		return fmt.Errorf("%w: port %d denied", errDestinationDenied, port)
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domainAllowed := false
+	if net.ParseIP(host) == nil {
+		if matchDomainList(a.DenyDomains, host) {
+			return fmt.Errorf("%w: domain %s denied", errDestinationDenied, host)
+		}
+		domainAllowed = matchDomainList(a.AllowDomains, host)
+	}
+
+	ips, err := resolveHost(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve %s: %v", errDestinationDenied, host, err)
+	}
+
+	allowNets, _ := parseCIDRList(a.AllowCIDRs)
+	denyNets, _ := parseCIDRList(a.DenyCIDRs)
+
+	for _, ip := range ips {
+		if matchCIDRList(denyNets, ip) {
+			return fmt.Errorf("%w: address %s denied", errDestinationDenied, ip)
+		}
+		if matchCIDRList(allowNets, ip) {
+			continue
+		}
+		if isInternalIP(ip) {
+			return fmt.Errorf("%w: internal address %s", errDestinationDenied, ip)
+		}
+		if a.DefaultDeny && !domainAllowed {
+			return fmt.Errorf("%w: %s not in allow list", errDestinationDenied, host)
+		}
+	}
+
+	return nil
+}
+
+// resolveHost 解析主机名，IP 字面量直接返回
+func resolveHost(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// isInternalIP 判断是否为内网、回环、链路本地或本机地址
+func isInternalIP(ip net.IP) bool {
+	if ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	// 本机网卡地址，避免通过公网 IP 访问管理端口
+	localAddrsOnce.Do(func() {
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				localAddrs = append(localAddrs, &net.IPNet{
+					IP:   ipNet.IP,
+					Mask: net.CIDRMask(len(ipNet.IP)*8, len(ipNet.IP)*8),
+				})
+			}
+		}
+	})
+	return matchCIDRList(localAddrs, ip)
+}
+
+// parseCIDRList 解析 CIDR 列表，单个 IP 视为主机地址
+func parseCIDRList(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid CIDR %q", entry)
+			}
+			bits := len(ip.To16()) * 8
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func matchCIDRList(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomainList 匹配域名及其子域名，支持 "*.example.com" 写法
+func matchDomainList(domains []string, host string) bool {
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "*.")
+		if domain == "" {
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTarget 拆分 host:port，缺少端口时使用默认端口
+func splitTarget(hostport string, defaultPort int) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// 没有端口
+		return strings.Trim(hostport, "[]"), defaultPort, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in %q", hostport)
+	}
+	return host, port, nil
+}
+
+// checkDestination 使用当前配置检查目标地址
+func (ps *ProxyServer) checkDestination(ctx context.Context, host string, port int) error {
+	ps.pool.mu.RLock()
+	acl := ps.pool.config.DestinationACL
+	ps.pool.mu.RUnlock()
+
+	return acl.Check(ctx, host, port)
+}
+
+// ClientACL 入口监听器的来源 IP 白名单
+type ClientACL struct {
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+	TrustedCIDRs []string `json:"trusted_cidrs"`
+}
+
+// validate 检查来源 CIDR 是否合法
+func (a *ClientACL) validate() error {
+	if _, err := parseCIDRList(a.AllowedCIDRs); err != nil {
+		return err
+	}
+	_, err := parseCIDRList(a.TrustedCIDRs)
+	return err
+}
+
+// Check 判断来源地址是否允许连接，trusted 表示可跳过凭证认证。
+// AllowedCIDRs 为空时允许所有来源，受信任网段始终允许。
+func (a *ClientACL) Check(remoteAddr string) (allowed, trusted bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false, false
+	}
+
+	trustedNets, _ := parseCIDRList(a.TrustedCIDRs)
+	if matchCIDRList(trustedNets, ip) {
+		return true, true
+	}
+
+	if len(a.AllowedCIDRs) == 0 {
+		return true, false
+	}
+	allowedNets, _ := parseCIDRList(a.AllowedCIDRs)
+	return matchCIDRList(allowedNets, ip), false
+}
+
+// checkClient 使用对应监听器的配置检查客户端来源，拒绝时计入统计
+func (ps *ProxyServer) checkClient(socks5 bool, remoteAddr string) (allowed, trusted bool) {
+	ps.pool.mu.RLock()
+	clientACL := ps.pool.config.HTTPClientACL
+	if socks5 {
+		clientACL = ps.pool.config.SOCKS5ClientACL
+	}
+	ps.pool.mu.RUnlock()
+
+	allowed, trusted = clientACL.Check(remoteAddr)
+	if !allowed {
+		atomic.AddInt64(&ps.pool.stats.RejectedClients, 1)
+		log.Printf("Rejected client %s", remoteAddr)
+	}
+	return allowed, trusted
+}
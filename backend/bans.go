@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultBanCooldown 规则未设置冷却时间时的默认值 (秒)
+const defaultBanCooldown = 600
+
+// maxBanPeek 检查响应体时最多缓冲的字节数
+const maxBanPeek = 64 * 1024
+
+// BanRule 目标站点封禁识别规则，命中后代理对该域名进入冷却，对其他域名不受影响
+type BanRule struct {
+	Name           string            `json:"name"`
+	Domains        []string          `json:"domains"`
+	StatusCodes    []int             `json:"status_codes"`
+	HeaderPatterns map[string]string `json:"header_patterns"`
+	BodyPatterns   []string          `json:"body_patterns"`
+	ConnectReset   bool              `json:"connect_reset"`
+	Cooldown       int               `json:"cooldown"`
+
+	headerRegexps map[string]*regexp.Regexp
+	bodyRegexps   []*regexp.Regexp
+}
+
+// DomainBan 代理对某个域名的冷却记录
+type DomainBan struct {
+	ProxyID string    `json:"proxy_id"`
+	Domain  string    `json:"domain"`
+	Rule    string    `json:"rule"`
+	Until   time.Time `json:"until"`
+}
+
+// banState 内存中的域名冷却表，键为 代理ID|域名
+type banState struct {
+	mu      sync.Mutex
+	entries map[string]DomainBan
+}
+
+func (rule *BanRule) validate() error {
+	if rule.Cooldown < 0 {
+		return fmt.Errorf("ban rule %q cooldown must not be negative", rule.Name)
+	}
+	if len(rule.StatusCodes) == 0 && len(rule.HeaderPatterns) == 0 && len(rule.BodyPatterns) == 0 && !rule.ConnectReset {
+		return fmt.Errorf("ban rule %q has no conditions", rule.Name)
+	}
+	return rule.compile()
+}
+
+// compile 编译响应头和响应体的正则表达式并缓存在规则中，匹配响应时不再重复编译
+func (rule *BanRule) compile() error {
+	headerRegexps := make(map[string]*regexp.Regexp, len(rule.HeaderPatterns))
+	for name, pattern := range rule.HeaderPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("ban rule %q header %s: %w", rule.Name, name, err)
+		}
+		headerRegexps[name] = re
+	}
+	bodyRegexps := make([]*regexp.Regexp, 0, len(rule.BodyPatterns))
+	for _, pattern := range rule.BodyPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("ban rule %q body pattern: %w", rule.Name, err)
+		}
+		bodyRegexps = append(bodyRegexps, re)
+	}
+	rule.headerRegexps = headerRegexps
+	rule.bodyRegexps = bodyRegexps
+	return nil
+}
+
+// validateBanRules 检查封禁规则列表并编译其中的正则表达式
+func validateBanRules(rules []BanRule) error {
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appliesTo 判断规则是否适用于目标域名，未设置域名时适用于全部
+func (rule *BanRule) appliesTo(host string) bool {
+	return len(rule.Domains) == 0 || matchDomainList(rule.Domains, host)
+}
+
+func (rule *BanRule) cooldown() time.Duration {
+	if rule.Cooldown == 0 {
+		return defaultBanCooldown * time.Second
+	}
+	return time.Duration(rule.Cooldown) * time.Second
+}
+
+// matchResponse 按状态码和响应头判断是否被封禁，任一条件命中即视为封禁
+func (rule *BanRule) matchResponse(resp *http.Response) bool {
+	if containsInt(rule.StatusCodes, resp.StatusCode) {
+		return true
+	}
+	for name, re := range rule.headerRegexps {
+		for _, value := range resp.Header.Values(name) {
+			if re.MatchString(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchBody 按响应体规则判断是否被封禁，body 为解压后的响应体开头部分
+func (rule *BanRule) matchBody(body []byte) bool {
+	for _, re := range rule.bodyRegexps {
+		if re.Match(body) {
+			return true
+		}
+	}
+	return false
+}
+
+func banKey(proxyID, host string) string {
+	return proxyID + "|" + host
+}
+
+// banned 判断代理对该域名是否处于冷却中
+func (b *banState) banned(proxyID, host string) bool {
+	if host == "" {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ban, ok := b.entries[banKey(proxyID, host)]
+	if !ok {
+		return false
+	}
+	if time.Now().After(ban.Until) {
+		delete(b.entries, banKey(proxyID, host))
+		return false
+	}
+	return true
+}
+
+// add 记录代理对域名的冷却
+func (b *banState) add(ban DomainBan) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.entries == nil {
+		b.entries = make(map[string]DomainBan)
+	}
+	b.entries[banKey(ban.ProxyID, ban.Domain)] = ban
+}
+
+// list 返回仍在冷却中的记录，按结束时间排序
+func (b *banState) list() []DomainBan {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	bans := make([]DomainBan, 0, len(b.entries))
+	for key, ban := range b.entries {
+		if now.After(ban.Until) {
+			delete(b.entries, key)
+			continue
+		}
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Until.Before(bans[j].Until) })
+	return bans
+}
+
+// clear 清除冷却记录，proxyID 为空时清除全部
+func (b *banState) clear(proxyID string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	removed := 0
+	for key, ban := range b.entries {
+		if proxyID == "" || ban.ProxyID == proxyID {
+			delete(b.entries, key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// banRulesFor 返回适用于目标域名的规则
+func (p *ProxyPool) banRulesFor(host string) []BanRule {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var rules []BanRule
+	for _, rule := range p.config.BanRules {
+		if rule.appliesTo(host) {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// banProxy 将代理对该域名置于冷却
+func (p *ProxyPool) banProxy(proxy *Proxy, host string, rule *BanRule) {
+	p.bans.add(DomainBan{
+		ProxyID: proxy.ID,
+		Domain:  host,
+		Rule:    rule.Name,
+		Until:   time.Now().Add(rule.cooldown()),
+	})
+	log.Printf("Proxy %s:%d banned by %s (rule %q), cooling down for %s", proxy.Address, proxy.Port, host, rule.Name, rule.cooldown())
+}
+
+// responseInspection 转发响应体时缓存开头 maxBanPeek 字节，转发结束后按响应体规则检查，
+// 不会为了检查而推迟响应头或阻塞流式响应
+type responseInspection struct {
+	pool     *ProxyPool
+	proxy    *Proxy
+	host     string
+	rules    []BanRule
+	body     io.Reader
+	encoding string
+	peek     bytes.Buffer
+	banned   bool
+}
+
+// Read 读取上游响应体，有响应体规则时同时缓存开头部分供 finish 检查
+func (ri *responseInspection) Read(b []byte) (int, error) {
+	n, err := ri.body.Read(b)
+	if room := maxBanPeek - ri.peek.Len(); len(ri.rules) > 0 && room > 0 && n > 0 {
+		ri.peek.Write(b[:min(n, room)])
+	}
+	return n, err
+}
+
+// finish 响应体转发结束后调用，按响应体规则检查已缓存的内容，返回代理是否被封禁
+func (ri *responseInspection) finish() bool {
+	if ri.banned || ri.peek.Len() == 0 {
+		return ri.banned
+	}
+
+	body, err := decodeBanPeek(ri.peek.Bytes(), ri.encoding)
+	if err != nil {
+		log.Printf("Ban body rules skipped for %s: %v", ri.host, err)
+		return false
+	}
+	for i := range ri.rules {
+		if ri.rules[i].matchBody(body) {
+			ri.pool.banProxy(ri.proxy, ri.host, &ri.rules[i])
+			ri.banned = true
+			break
+		}
+	}
+	return ri.banned
+}
+
+// decodeBanPeek 按 Content-Encoding 解压缓存的响应体开头部分，缓存可能被截断，解出多少用多少
+func decodeBanPeek(data []byte, encoding string) ([]byte, error) {
+	var reader io.Reader
+	var err error
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return data, nil
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, maxBanPeek))
+	if len(body) == 0 && err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// inspectResponse 按状态码和响应头规则检查 HTTP 响应，命中时冷却代理。
+// 返回的 responseInspection 用于转发响应体，转发结束后调用 finish 检查响应体规则
+func (p *ProxyPool) inspectResponse(proxy *Proxy, host string, resp *http.Response) *responseInspection {
+	ri := &responseInspection{
+		pool:     p,
+		proxy:    proxy,
+		host:     host,
+		body:     resp.Body,
+		encoding: resp.Header.Get("Content-Encoding"),
+	}
+
+	rules := p.banRulesFor(host)
+	for i := range rules {
+		if rules[i].matchResponse(resp) {
+			p.banProxy(proxy, host, &rules[i])
+			ri.banned = true
+			return ri
+		}
+		if len(rules[i].bodyRegexps) > 0 {
+			ri.rules = append(ri.rules, rules[i])
+		}
+	}
+	return ri
+}
+
+// inspectTunnel 隧道在目标返回任何数据前被重置或关闭时，按规则冷却代理
+func (p *ProxyPool) inspectTunnel(proxy *Proxy, host string, downstream int64, err error) {
+	if downstream > 0 || !isHandshakeReset(err) {
+		return
+	}
+
+	rules := p.banRulesFor(host)
+	for i := range rules {
+		if rules[i].ConnectReset {
+			p.banProxy(proxy, host, &rules[i])
+			return
+		}
+	}
+}
+
+// isHandshakeReset 判断目标是否主动重置或关闭了连接
+func isHandshakeReset(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// normalizeHost 统一域名格式用于冷却表
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// GetBansHandler 列出冷却中的代理和域名
+func (p *ProxyPool) GetBansHandler(c *gin.Context) {
+	bans := p.bans.list()
+	c.JSON(http.StatusOK, gin.H{
+		"bans":  bans,
+		"total": len(bans),
+	})
+}
+
+// ClearBansHandler 清除冷却记录，?proxy_id= 只清除指定代理
+func (p *ProxyPool) ClearBansHandler(c *gin.Context) {
+	removed := p.bans.clear(c.Query("proxy_id"))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Bans cleared",
+		"removed": removed,
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func gzipBytes(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspectResponseBody(t *testing.T) {
+	p := NewProxyPool()
+	p.config.BanRules = []BanRule{{Name: "captcha", BodyPatterns: []string{"(?i)captcha"}}}
+	if err := validateBanRules(p.config.BanRules); err != nil {
+		t.Fatal(err)
+	}
+
+	page := "<html>" + strings.Repeat("x", 100) + "Please solve the CAPTCHA</html>"
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     bool
+	}{
+		{"plain", "", []byte(page), true},
+		{"gzip", "gzip", gzipBytes(t, page), true},
+		{"gzip truncated", "gzip", gzipBytes(t, page)[:40], false},
+		{"clean", "", []byte("<html>hello</html>"), false},
+		{"unsupported encoding", "br", []byte(page), false},
+	}
+	for _, tt := range tests {
+		proxy := &Proxy{ID: tt.name}
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(bytes.NewReader(tt.body))}
+		if tt.encoding != "" {
+			resp.Header.Set("Content-Encoding", tt.encoding)
+		}
+
+		inspection := p.inspectResponse(proxy, "example.com", resp)
+		relayed, err := io.ReadAll(inspection)
+		if err != nil || !bytes.Equal(relayed, tt.body) {
+			t.Errorf("%s: relayed body changed (err %v)", tt.name, err)
+		}
+		if got := inspection.finish(); got != tt.want {
+			t.Errorf("%s: banned = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := p.bans.banned(proxy.ID, "example.com"); got != tt.want {
+			t.Errorf("%s: ban recorded = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInspectResponseHeaders(t *testing.T) {
+	p := NewProxyPool()
+	p.config.BanRules = []BanRule{{Name: "blocked", StatusCodes: []int{http.StatusForbidden}, BodyPatterns: []string{"never"}}}
+	if err := validateBanRules(p.config.BanRules); err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := &Proxy{ID: "p1"}
+	resp := &http.Response{StatusCode: http.StatusForbidden, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("denied"))}
+	inspection := p.inspectResponse(proxy, "example.com", resp)
+	if !p.bans.banned(proxy.ID, "example.com") {
+		t.Errorf("status rule did not ban before the body was relayed")
+	}
+	io.ReadAll(inspection)
+	if !inspection.finish() {
+		t.Errorf("finish lost the status ban")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ProxyCapabilities 验证时探测到的代理能力，未探测的代理视为全部支持
+type ProxyCapabilities struct {
+	Connect      bool      `json:"connect"`
+	Ports        []int     `json:"ports"`
+	BlockedPorts []int     `json:"blocked_ports"`
+	UDP          bool      `json:"udp"`
+	HTTP2        bool      `json:"http2"`
+	CheckedAt    time.Time `json:"checked_at"`
+}
+
+// supports 判断代理能否处理指定条件的请求
+func (proxy *Proxy) supports(opts SelectOptions) bool {
+	caps := proxy.Capabilities
+	if caps == nil {
+		return true
+	}
+	if opts.NeedConnect && !caps.Connect {
+		return false
+	}
+	if opts.Port > 0 && containsInt(caps.BlockedPorts, opts.Port) {
+		return false
+	}
+	return true
+}
+
+// capabilityHost 端口探测使用的目标主机，未配置时使用健康检查地址的主机
+func (c *Config) capabilityHost() string {
+	if c.CapabilityHost != "" {
+		return c.CapabilityHost
+	}
+	targets, _ := c.healthCheckTargets()
+	for _, target := range targets {
+		if u, err := url.Parse(target.URL); err == nil && u.Hostname() != "" {
+			return u.Hostname()
+		}
+	}
+	return "www.google.com"
+}
+
+// probeCapabilities 探测 CONNECT 隧道、目标端口、HTTP/2 和 SOCKS5 UDP 支持
+func (p *ProxyPool) probeCapabilities(proxy *Proxy) *ProxyCapabilities {
+	p.mu.RLock()
+	timeout := time.Duration(p.config.Timeout) * time.Second
+	targets, _ := p.config.healthCheckTargets()
+	host := p.config.capabilityHost()
+	ports := append([]int(nil), p.config.CapabilityPorts...)
+	p.mu.RUnlock()
+
+	caps := &ProxyCapabilities{CheckedAt: time.Now()}
+
+	// 健康检查目标已确认可达，隧道失败说明代理不支持 CONNECT
+	conn, err := dialUpstream(context.Background(), proxy, probeTarget(targets), timeout)
+	if err != nil {
+		return caps
+	}
+	conn.Close()
+	caps.Connect = true
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, port := range ports {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			conn, err := dialUpstream(context.Background(), proxy, net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				caps.BlockedPorts = append(caps.BlockedPorts, port)
+				return
+			}
+			conn.Close()
+			caps.Ports = append(caps.Ports, port)
+		}(port)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		supported := probeHTTP2(proxy, host, timeout) == nil
+		mu.Lock()
+		caps.HTTP2 = supported
+		mu.Unlock()
+	}()
+
+	if proxy.Type == SOCKS5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			supported := probeSOCKS5UDP(proxy, timeout) == nil
+			mu.Lock()
+			caps.UDP = supported
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	sort.Ints(caps.Ports)
+	sort.Ints(caps.BlockedPorts)
+	return caps
+}
+
+// probeHTTP2 通过隧道与目标进行 TLS 握手，协商出 h2 即视为支持 HTTP/2
+func probeHTTP2(proxy *Proxy, host string, timeout time.Duration) error {
+	conn, err := dialUpstream(context.Background(), proxy, net.JoinHostPort(host, "443"), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		NextProtos:         []string{"h2", "http/1.1"},
+		InsecureSkipVerify: true,
+	})
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	if protocol := tlsConn.ConnectionState().NegotiatedProtocol; protocol != "h2" {
+		return fmt.Errorf("negotiated %q instead of h2", protocol)
+	}
+	return nil
+}
+
+// probeSOCKS5UDP 发送 UDP ASSOCIATE 请求，代理应答成功即视为支持 UDP
+func probeSOCKS5UDP(proxy *Proxy, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", proxy.addr(), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if err := socks5Handshake(conn, proxy); err != nil {
+		return err
+	}
+
+	if _, err := conn.Write([]byte{0x05, 0x03, 0x00, 0x01, 0, 0, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0x00 {
+		return fmt.Errorf("UDP associate rejected (code 0x%02x)", reply[1])
+	}
+	return nil
+}
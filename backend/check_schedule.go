@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// stableStreak 连续成功多少次后视为稳定，检查间隔翻倍
+	stableStreak = 5
+	// maxStableFactor 稳定代理检查间隔相对 CheckInterval 的最大倍数
+	maxStableFactor = 4
+	// minCheckDelay 最短检查间隔
+	minCheckDelay = 5 * time.Second
+)
+
+// scheduleNextCheck 根据检查结果安排下次检查，调用方需持有写锁。
+// 稳定的代理逐步降低检查频率，刚失败的代理尽快复查，
+// 已失效的代理按指数退避重试，最长不超过 RefreshInterval。
+func (p *ProxyPool) scheduleNextCheck(proxy *Proxy, success bool) {
+	base := time.Duration(p.config.CheckInterval) * time.Second
+	if base < minCheckDelay {
+		base = minCheckDelay
+	}
+
+	var delay time.Duration
+	switch {
+	case success:
+		proxy.successStreak++
+		factor := 1 << (proxy.successStreak / stableStreak)
+		if factor > maxStableFactor {
+			factor = maxStableFactor
+		}
+		delay = base * time.Duration(factor)
+	case proxy.Status != StatusInactive:
+		proxy.successStreak = 0
+		delay = base / 2
+	default:
+		proxy.successStreak = 0
+		delay = base
+		limit := time.Duration(p.config.RefreshInterval) * time.Second
+		for i := int64(1); i < proxy.FailCount && delay < limit; i++ {
+			delay *= 2
+		}
+		if limit > base && delay > limit {
+			delay = limit
+		}
+	}
+
+	proxy.NextCheck = time.Now().Add(jitter(delay))
+}
+
+// jitter 在 ±10% 范围内随机调整间隔，避免检查集中在同一时刻
+func jitter(delay time.Duration) time.Duration {
+	if delay < minCheckDelay {
+		delay = minCheckDelay
+	}
+	spread := int64(delay) / 5
+	return delay - time.Duration(spread/2) + time.Duration(rand.Int63n(spread+1))
+}
+
+// spreadChecks 为启动时加载的代理在一个检查周期内均匀安排首次检查，调用方需持有写锁
+func (p *ProxyPool) spreadChecks() {
+	interval := time.Duration(p.config.CheckInterval) * time.Second
+	if interval < minCheckDelay {
+		interval = minCheckDelay
+	}
+
+	now := time.Now()
+	for _, proxy := range p.proxies {
+		proxy.NextCheck = now.Add(time.Duration(rand.Int63n(int64(interval))))
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func bitsOf(values ...int) uint64 {
+	var bits uint64
+	for _, v := range values {
+		bits |= 1 << uint(v)
+	}
+	return bits
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     uint64
+		wantErr  bool
+	}{
+		{field: "*", min: 0, max: 5, want: bitsOf(0, 1, 2, 3, 4, 5)},
+		{field: "3", min: 0, max: 59, want: bitsOf(3)},
+		{field: "1-4", min: 0, max: 59, want: bitsOf(1, 2, 3, 4)},
+		{field: "*/15", min: 0, max: 59, want: bitsOf(0, 15, 30, 45)},
+		{field: "10-20/5", min: 0, max: 59, want: bitsOf(10, 15, 20)},
+		{field: "50/5", min: 0, max: 59, want: bitsOf(50, 55)},
+		{field: "1,3,5-6", min: 0, max: 7, want: bitsOf(1, 3, 5, 6)},
+		{field: "1-12/4", min: 1, max: 12, want: bitsOf(1, 5, 9)},
+		{field: "60", min: 0, max: 59, wantErr: true},
+		{field: "0", min: 1, max: 31, wantErr: true},
+		{field: "5-1", min: 0, max: 59, wantErr: true},
+		{field: "*/0", min: 0, max: 59, wantErr: true},
+		{field: "*/x", min: 0, max: 59, wantErr: true},
+		{field: "a", min: 0, max: 59, wantErr: true},
+		{field: "1-2-3", min: 0, max: 59, wantErr: true},
+		{field: "1,", min: 0, max: 59, wantErr: true},
+		{field: "", min: 0, max: 59, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseCronField(tt.field, tt.min, tt.max)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseCronField(%q) = %b, want error", tt.field, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCronField(%q) error: %v", tt.field, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCronField(%q) = %b, want %b", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"@every",
+		"@every 500ms",
+		"@every soon",
+		"@fortnightly",
+	} {
+		if _, err := parseSchedule(spec); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded, want error", spec)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	at := func(value string) time.Time {
+		ts, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ts
+	}
+
+	tests := []struct {
+		spec  string
+		after string
+		want  string
+	}{
+		{"@every 90s", "2026-10-19 10:07:30", "2026-10-19 10:09:00"},
+		{"*/15 * * * *", "2026-10-19 10:07:30", "2026-10-19 10:15:00"},
+		{"*/15 * * * *", "2026-10-19 10:15:00", "2026-10-19 10:30:00"},
+		{"0 3 * * *", "2026-10-19 03:00:00", "2026-10-20 03:00:00"},
+		{"0 3 * * *", "2026-10-19 02:59:59", "2026-10-19 03:00:00"},
+		{"@hourly", "2026-10-19 23:30:00", "2026-10-20 00:00:00"},
+		{"@yearly", "2026-10-19 10:00:00", "2027-01-01 00:00:00"},
+		{"30 9 * * 1-5", "2026-10-17 10:00:00", "2026-10-19 09:30:00"},
+		{"0 12 * 11 *", "2026-10-19 10:00:00", "2026-11-01 12:00:00"},
+		// 周日写作 0 或 7
+		{"0 0 * * 7", "2026-10-19 10:00:00", "2026-10-25 00:00:00"},
+		{"0 0 * * 0", "2026-10-19 10:00:00", "2026-10-25 00:00:00"},
+		// 日和周同时限制时满足其一即可
+		{"0 0 13 * 5", "2026-10-19 10:00:00", "2026-10-23 00:00:00"},
+		{"0 0 20 * 5", "2026-10-19 10:00:00", "2026-10-20 00:00:00"},
+		// 日或周为 * 时只看另一个
+		{"0 0 23 * *", "2026-10-19 10:00:00", "2026-10-23 00:00:00"},
+		{"0 0 * * 5", "2026-10-19 10:00:00", "2026-10-23 00:00:00"},
+		{"0 0 29 2 *", "2026-10-19 10:00:00", "2028-02-29 00:00:00"},
+	}
+	for _, tt := range tests {
+		s, err := parseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("parseSchedule(%q) error: %v", tt.spec, err)
+			continue
+		}
+		if got := s.next(at(tt.after)); !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s = %s, want %s", tt.spec, tt.after, got.Format("2006-01-02 15:04:05"), tt.want)
+		}
+	}
+
+	// 永远不会出现的日期返回零值
+	s, err := parseSchedule("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.next(at("2026-10-19 10:00:00")); !got.IsZero() {
+		t.Errorf("31 February scheduled at %s", got)
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"log"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Database struct {
-	db *sql.DB
+	db   *sql.DB
+	path string
 }
 
 func NewDatabase(dbPath string) (*Database, error) {
@@ -17,7 +21,7 @@ func NewDatabase(dbPath string) (*Database, error) {
 		return nil, err
 	}
 
-	database := &Database{db: db}
+	database := &Database{db: db, path: dbPath}
 	if err := database.initTables(); err != nil {
 		return nil, err
 	}
@@ -40,7 +44,26 @@ func (d *Database) initTables() error {
 		success_count INTEGER DEFAULT 0,
 		fail_count INTEGER DEFAULT 0,
 		last_check DATETIME,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		tags TEXT DEFAULT '[]',
+		bytes_up INTEGER DEFAULT 0,
+		bytes_down INTEGER DEFAULT 0,
+		monthly_bytes INTEGER DEFAULT 0,
+		usage_month TEXT DEFAULT '',
+		monthly_data_cap INTEGER DEFAULT 0,
+		anonymity TEXT DEFAULT '',
+		exit_ip TEXT DEFAULT '',
+		protocols TEXT DEFAULT '[]',
+		tls INTEGER DEFAULT 0,
+		capabilities TEXT DEFAULT '',
+		last_error_class TEXT DEFAULT '',
+		last_error TEXT DEFAULT '',
+		last_error_at DATETIME,
+		throughput INTEGER DEFAULT 0,
+		untrusted INTEGER DEFAULT 0,
+		profile_health TEXT DEFAULT '{}',
+		source_id TEXT DEFAULT '',
+		country TEXT DEFAULT ''
 	);`
 
 	// 创建配置表
@@ -56,7 +79,30 @@ func (d *Database) initTables() error {
 		auto_refresh INTEGER DEFAULT 1,
 		enable_auth INTEGER DEFAULT 0,
 		auth_username TEXT,
-		auth_password TEXT
+		auth_password TEXT,
+		destination_acl TEXT DEFAULT '{}',
+		http_client_acl TEXT DEFAULT '{}',
+		socks5_client_acl TEXT DEFAULT '{}',
+		judge_url TEXT DEFAULT '',
+		min_anonymity TEXT DEFAULT '',
+		health_checks TEXT DEFAULT '[]',
+		health_check_quorum INTEGER DEFAULT 0,
+		validation_workers INTEGER DEFAULT 50,
+		ip_echo_url TEXT DEFAULT '',
+		collapse_duplicate_exits INTEGER DEFAULT 0,
+		capability_ports TEXT DEFAULT '[]',
+		capability_host TEXT DEFAULT '',
+		history_retention_days INTEGER DEFAULT 7,
+		throughput_url TEXT DEFAULT '',
+		throughput_bytes INTEGER DEFAULT 0,
+		min_throughput INTEGER DEFAULT 0,
+		skip_tls_verify INTEGER DEFAULT 0,
+		tls_check_host TEXT DEFAULT '',
+		health_profiles TEXT DEFAULT '[]',
+		ban_rules TEXT DEFAULT '[]',
+		jobs TEXT DEFAULT '[]',
+		backup_retention INTEGER DEFAULT 7,
+		shutdown_timeout INTEGER DEFAULT 30
 	);`
 
 	if _, err := d.db.Exec(proxyTable); err != nil {
@@ -67,17 +113,219 @@ func (d *Database) initTables() error {
 		return err
 	}
 
+	// 创建入口账号表
+	userTable := `
+	CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		enabled INTEGER DEFAULT 1,
+		allowed_tags TEXT DEFAULT '[]',
+		allowed_destinations TEXT DEFAULT '[]',
+		rotation_mode TEXT DEFAULT '',
+		expires_at DATETIME,
+		daily_byte_quota INTEGER DEFAULT 0,
+		monthly_byte_quota INTEGER DEFAULT 0,
+		daily_request_quota INTEGER DEFAULT 0,
+		monthly_request_quota INTEGER DEFAULT 0,
+		bandwidth_limit INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := d.db.Exec(userTable); err != nil {
+		return err
+	}
+
+	// 创建账号用量表，period 为日 (2006-01-02) 或月 (2006-01)
+	usageTable := `
+	CREATE TABLE IF NOT EXISTS user_usage (
+		user_id TEXT NOT NULL,
+		period TEXT NOT NULL,
+		bytes INTEGER DEFAULT 0,
+		requests INTEGER DEFAULT 0,
+		PRIMARY KEY (user_id, period)
+	);`
+
+	if _, err := d.db.Exec(usageTable); err != nil {
+		return err
+	}
+
+	// 创建代理检查历史表
+	checksTable := `
+	CREATE TABLE IF NOT EXISTS proxy_checks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		proxy_id TEXT NOT NULL,
+		checked_at DATETIME NOT NULL,
+		success INTEGER DEFAULT 0,
+		latency INTEGER DEFAULT 0,
+		error_class TEXT DEFAULT '',
+		error TEXT DEFAULT '',
+		exit_ip TEXT DEFAULT ''
+	);
+	CREATE INDEX IF NOT EXISTS idx_proxy_checks_proxy ON proxy_checks (proxy_id, checked_at);
+	CREATE TABLE IF NOT EXISTS domain_stats (
+		proxy_id TEXT NOT NULL,
+		domain TEXT NOT NULL,
+		requests INTEGER DEFAULT 0,
+		successes INTEGER DEFAULT 0,
+		failures INTEGER DEFAULT 0,
+		latency_total INTEGER DEFAULT 0,
+		score REAL DEFAULT 0.5,
+		last_success DATETIME,
+		last_failure DATETIME,
+		updated_at DATETIME,
+		PRIMARY KEY (proxy_id, domain)
+	);`
+
+	if _, err := d.db.Exec(checksTable); err != nil {
+		return err
+	}
+
+	// 创建订阅源表
+	sourceTable := `
+	CREATE TABLE IF NOT EXISTS sources (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		format TEXT DEFAULT 'text',
+		enabled INTEGER DEFAULT 1,
+		refresh_interval INTEGER DEFAULT 3600,
+		tags TEXT DEFAULT '[]',
+		type TEXT DEFAULT '',
+		username TEXT DEFAULT '',
+		password TEXT DEFAULT '',
+		proxy_username TEXT DEFAULT '',
+		proxy_password TEXT DEFAULT '',
+		headers TEXT DEFAULT '{}',
+		remove_missing INTEGER DEFAULT 0,
+		stats TEXT DEFAULT '{}',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+
+	if _, err := d.db.Exec(sourceTable); err != nil {
+		return err
+	}
+
+	// 旧版本数据库补充新增的列
+	columns := []struct{ table, name, definition string }{
+		{"proxies", "tags", "TEXT DEFAULT '[]'"},
+		{"proxies", "bytes_up", "INTEGER DEFAULT 0"},
+		{"proxies", "bytes_down", "INTEGER DEFAULT 0"},
+		{"proxies", "monthly_bytes", "INTEGER DEFAULT 0"},
+		{"proxies", "usage_month", "TEXT DEFAULT ''"},
+		{"proxies", "monthly_data_cap", "INTEGER DEFAULT 0"},
+		{"proxies", "anonymity", "TEXT DEFAULT ''"},
+		{"proxies", "exit_ip", "TEXT DEFAULT ''"},
+		{"proxies", "protocols", "TEXT DEFAULT '[]'"},
+		{"proxies", "tls", "INTEGER DEFAULT 0"},
+		{"proxies", "capabilities", "TEXT DEFAULT ''"},
+		{"proxies", "last_error_class", "TEXT DEFAULT ''"},
+		{"proxies", "last_error", "TEXT DEFAULT ''"},
+		{"proxies", "last_error_at", "DATETIME"},
+		{"proxies", "throughput", "INTEGER DEFAULT 0"},
+		{"proxies", "untrusted", "INTEGER DEFAULT 0"},
+		{"proxies", "profile_health", "TEXT DEFAULT '{}'"},
+		{"proxies", "source_id", "TEXT DEFAULT ''"},
+		{"proxies", "country", "TEXT DEFAULT ''"},
+		{"users", "daily_byte_quota", "INTEGER DEFAULT 0"},
+		{"users", "monthly_byte_quota", "INTEGER DEFAULT 0"},
+		{"users", "daily_request_quota", "INTEGER DEFAULT 0"},
+		{"users", "monthly_request_quota", "INTEGER DEFAULT 0"},
+		{"users", "bandwidth_limit", "INTEGER DEFAULT 0"},
+		{"config", "destination_acl", "TEXT DEFAULT '{}'"},
+		{"config", "http_client_acl", "TEXT DEFAULT '{}'"},
+		{"config", "socks5_client_acl", "TEXT DEFAULT '{}'"},
+		{"config", "judge_url", "TEXT DEFAULT ''"},
+		{"config", "min_anonymity", "TEXT DEFAULT ''"},
+		{"config", "health_checks", "TEXT DEFAULT '[]'"},
+		{"config", "health_check_quorum", "INTEGER DEFAULT 0"},
+		{"config", "validation_workers", "INTEGER DEFAULT 50"},
+		{"config", "ip_echo_url", "TEXT DEFAULT ''"},
+		{"config", "collapse_duplicate_exits", "INTEGER DEFAULT 0"},
+		{"config", "capability_ports", "TEXT DEFAULT '[]'"},
+		{"config", "capability_host", "TEXT DEFAULT ''"},
+		{"config", "history_retention_days", "INTEGER DEFAULT 7"},
+		{"config", "throughput_url", "TEXT DEFAULT ''"},
+		{"config", "throughput_bytes", "INTEGER DEFAULT 0"},
+		{"config", "min_throughput", "INTEGER DEFAULT 0"},
+		{"config", "skip_tls_verify", "INTEGER DEFAULT 0"},
+		{"config", "tls_check_host", "TEXT DEFAULT ''"},
+		{"config", "health_profiles", "TEXT DEFAULT '[]'"},
+		{"config", "ban_rules", "TEXT DEFAULT '[]'"},
+		{"config", "jobs", "TEXT DEFAULT '[]'"},
+		{"config", "backup_retention", "INTEGER DEFAULT 7"},
+		{"config", "shutdown_timeout", "INTEGER DEFAULT 30"},
+	}
+	for _, col := range columns {
+		if err := d.addColumn(col.table, col.name, col.definition); err != nil {
+			return err
+		}
+	}
+
 	// 插入默认配置
 	d.db.Exec(`INSERT OR IGNORE INTO config (id) VALUES (1)`)
 
 	return nil
 }
 
+// addColumn 在列不存在时为表添加列
+func (d *Database) addColumn(table, column, definition string) error {
+	rows, err := d.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// toJSON 将结构化字段序列化后存入 TEXT 列
+func toJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// fromJSON 从 TEXT 列还原结构化字段，空值保持零值
+func fromJSON(data sql.NullString, v interface{}) {
+	if !data.Valid || data.String == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(data.String), v); err != nil {
+		log.Printf("Error decoding JSON column: %v", err)
+	}
+}
+
 // SaveProxy 保存代理到数据库
 func (d *Database) SaveProxy(proxy *Proxy) error {
 	query := `INSERT OR REPLACE INTO proxies
-		(id, address, port, type, username, password, status, response_time, success_count, fail_count, last_check)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		(id, address, port, type, username, password, status, response_time, success_count, fail_count, last_check, created_at, tags,
+		bytes_up, bytes_down, monthly_bytes, usage_month, monthly_data_cap, anonymity,
+		exit_ip, protocols, tls, capabilities, last_error_class, last_error, last_error_at, throughput, untrusted, profile_health, source_id, country)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	_, err := d.db.Exec(query,
 		proxy.ID,
@@ -91,13 +339,35 @@ func (d *Database) SaveProxy(proxy *Proxy) error {
 		proxy.SuccessCount,
 		proxy.FailCount,
 		proxy.LastCheck,
+		proxy.CreatedAt,
+		toJSON(proxy.Tags),
+		proxy.BytesUp,
+		proxy.BytesDown,
+		proxy.MonthlyBytes,
+		proxy.UsageMonth,
+		proxy.MonthlyDataCap,
+		proxy.Anonymity,
+		proxy.ExitIP,
+		toJSON(proxy.Protocols),
+		proxy.TLS,
+		toJSON(proxy.Capabilities),
+		proxy.LastErrorClass,
+		proxy.LastError,
+		proxy.LastErrorAt,
+		proxy.Throughput,
+		proxy.Untrusted,
+		toJSON(proxy.ProfileHealth),
+		proxy.SourceID,
+		proxy.Country,
 	)
 	return err
 }
 
 // LoadProxies 从数据库加载所有代理
 func (d *Database) LoadProxies() ([]*Proxy, error) {
-	query := `SELECT id, address, port, type, username, password, status, response_time, success_count, fail_count, last_check
+	query := `SELECT id, address, port, type, username, password, status, response_time, success_count, fail_count, last_check,
+		created_at, tags, bytes_up, bytes_down, monthly_bytes, usage_month, monthly_data_cap,
+		anonymity, exit_ip, protocols, tls, capabilities, last_error_class, last_error, last_error_at, throughput, untrusted, profile_health, source_id, country
 		FROM proxies`
 
 	rows, err := d.db.Query(query)
@@ -109,6 +379,8 @@ func (d *Database) LoadProxies() ([]*Proxy, error) {
 	var proxies []*Proxy
 	for rows.Next() {
 		proxy := &Proxy{}
+		var tags, protocols, capabilities, profileHealth sql.NullString
+		var lastErrorAt sql.NullTime
 		err := rows.Scan(
 			&proxy.ID,
 			&proxy.Address,
@@ -121,18 +393,50 @@ func (d *Database) LoadProxies() ([]*Proxy, error) {
 			&proxy.SuccessCount,
 			&proxy.FailCount,
 			&proxy.LastCheck,
+			&proxy.CreatedAt,
+			&tags,
+			&proxy.BytesUp,
+			&proxy.BytesDown,
+			&proxy.MonthlyBytes,
+			&proxy.UsageMonth,
+			&proxy.MonthlyDataCap,
+			&proxy.Anonymity,
+			&proxy.ExitIP,
+			&protocols,
+			&proxy.TLS,
+			&capabilities,
+			&proxy.LastErrorClass,
+			&proxy.LastError,
+			&lastErrorAt,
+			&proxy.Throughput,
+			&proxy.Untrusted,
+			&profileHealth,
+			&proxy.SourceID,
+			&proxy.Country,
 		)
 		if err != nil {
 			log.Printf("Error scanning proxy: %v", err)
 			continue
 		}
+		fromJSON(tags, &proxy.Tags)
+		fromJSON(protocols, &proxy.Protocols)
+		fromJSON(capabilities, &proxy.Capabilities)
+		proxy.LastErrorAt = lastErrorAt.Time
+		fromJSON(profileHealth, &proxy.ProfileHealth)
+		proxy.savedBytes = proxy.BytesUp + proxy.BytesDown
 		proxies = append(proxies, proxy)
 	}
 	return proxies, nil
 }
 
-// DeleteProxy 从数据库删除代理
+// DeleteProxy 从数据库删除代理及其检查历史
 func (d *Database) DeleteProxy(id string) error {
+	if _, err := d.db.Exec(`DELETE FROM proxy_checks WHERE proxy_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := d.db.Exec(`DELETE FROM domain_stats WHERE proxy_id = ?`, id); err != nil {
+		return err
+	}
 	query := `DELETE FROM proxies WHERE id = ?`
 	_, err := d.db.Exec(query, id)
 	return err
@@ -150,7 +454,30 @@ func (d *Database) SaveConfig(config *Config) error {
 		auto_refresh = ?,
 		enable_auth = ?,
 		auth_username = ?,
-		auth_password = ?
+		auth_password = ?,
+		destination_acl = ?,
+		http_client_acl = ?,
+		socks5_client_acl = ?,
+		judge_url = ?,
+		min_anonymity = ?,
+		health_checks = ?,
+		health_check_quorum = ?,
+		validation_workers = ?,
+		ip_echo_url = ?,
+		collapse_duplicate_exits = ?,
+		capability_ports = ?,
+		capability_host = ?,
+		history_retention_days = ?,
+		throughput_url = ?,
+		throughput_bytes = ?,
+		min_throughput = ?,
+		skip_tls_verify = ?,
+		tls_check_host = ?,
+		health_profiles = ?,
+		ban_rules = ?,
+		jobs = ?,
+		backup_retention = ?,
+		shutdown_timeout = ?
 		WHERE id = 1`
 
 	_, err := d.db.Exec(query,
@@ -164,6 +491,29 @@ func (d *Database) SaveConfig(config *Config) error {
 		config.EnableAuth,
 		config.AuthUsername,
 		config.AuthPassword,
+		toJSON(config.DestinationACL),
+		toJSON(config.HTTPClientACL),
+		toJSON(config.SOCKS5ClientACL),
+		config.JudgeURL,
+		config.MinAnonymity,
+		toJSON(config.HealthChecks),
+		config.HealthCheckQuorum,
+		config.ValidationWorkers,
+		config.IPEchoURL,
+		config.CollapseDuplicateExits,
+		toJSON(config.CapabilityPorts),
+		config.CapabilityHost,
+		config.HistoryRetentionDays,
+		config.ThroughputURL,
+		config.ThroughputBytes,
+		config.MinThroughput,
+		config.SkipTLSVerify,
+		config.TLSCheckHost,
+		toJSON(config.HealthProfiles),
+		toJSON(config.BanRules),
+		toJSON(config.Jobs),
+		config.BackupRetention,
+		config.ShutdownTimeout,
 	)
 	return err
 }
@@ -171,10 +521,14 @@ func (d *Database) SaveConfig(config *Config) error {
 // LoadConfig 从数据库加载配置
 func (d *Database) LoadConfig() (*Config, error) {
 	query := `SELECT rotation_mode, health_check_url, check_interval, timeout, max_fail_count,
-		refresh_interval, auto_refresh, enable_auth, auth_username, auth_password
+		refresh_interval, auto_refresh, enable_auth, auth_username, auth_password, destination_acl,
+		http_client_acl, socks5_client_acl, judge_url, min_anonymity,
+		health_checks, health_check_quorum, validation_workers,
+		ip_echo_url, collapse_duplicate_exits, capability_ports, capability_host, history_retention_days, throughput_url, throughput_bytes, min_throughput, skip_tls_verify, tls_check_host, health_profiles, ban_rules, jobs, backup_retention, shutdown_timeout
 		FROM config WHERE id = 1`
 
 	config := &Config{}
+	var destinationACL, httpClientACL, socks5ClientACL, healthChecks, capabilityPorts, healthProfiles, banRules, jobs sql.NullString
 	err := d.db.QueryRow(query).Scan(
 		&config.RotationMode,
 		&config.HealthCheckURL,
@@ -186,13 +540,372 @@ func (d *Database) LoadConfig() (*Config, error) {
 		&config.EnableAuth,
 		&config.AuthUsername,
 		&config.AuthPassword,
+		&destinationACL,
+		&httpClientACL,
+		&socks5ClientACL,
+		&config.JudgeURL,
+		&config.MinAnonymity,
+		&healthChecks,
+		&config.HealthCheckQuorum,
+		&config.ValidationWorkers,
+		&config.IPEchoURL,
+		&config.CollapseDuplicateExits,
+		&capabilityPorts,
+		&config.CapabilityHost,
+		&config.HistoryRetentionDays,
+		&config.ThroughputURL,
+		&config.ThroughputBytes,
+		&config.MinThroughput,
+		&config.SkipTLSVerify,
+		&config.TLSCheckHost,
+		&healthProfiles,
+		&banRules,
+		&jobs,
+		&config.BackupRetention,
+		&config.ShutdownTimeout,
 	)
 	if err != nil {
 		return nil, err
 	}
+	fromJSON(destinationACL, &config.DestinationACL)
+	fromJSON(httpClientACL, &config.HTTPClientACL)
+	fromJSON(socks5ClientACL, &config.SOCKS5ClientACL)
+	fromJSON(healthChecks, &config.HealthChecks)
+	fromJSON(capabilityPorts, &config.CapabilityPorts)
+	fromJSON(healthProfiles, &config.HealthProfiles)
+	fromJSON(banRules, &config.BanRules)
+	fromJSON(jobs, &config.Jobs)
 	return config, nil
 }
 
+// SaveUser 保存入口账号
+func (d *Database) SaveUser(user *User) error {
+	query := `INSERT OR REPLACE INTO users
+		(id, username, password_hash, enabled, allowed_tags, allowed_destinations, rotation_mode, expires_at,
+		daily_byte_quota, monthly_byte_quota, daily_request_quota, monthly_request_quota, bandwidth_limit, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := d.db.Exec(query,
+		user.ID,
+		user.Username,
+		user.PasswordHash,
+		user.Enabled,
+		toJSON(user.AllowedTags),
+		toJSON(user.AllowedDestinations),
+		user.RotationMode,
+		user.ExpiresAt,
+		user.DailyByteQuota,
+		user.MonthlyByteQuota,
+		user.DailyRequestQuota,
+		user.MonthlyRequestQuota,
+		user.BandwidthLimit,
+		user.CreatedAt,
+	)
+	return err
+}
+
+// LoadUsers 加载所有入口账号
+func (d *Database) LoadUsers() ([]*User, error) {
+	query := `SELECT id, username, password_hash, enabled, allowed_tags, allowed_destinations, rotation_mode, expires_at,
+		daily_byte_quota, monthly_byte_quota, daily_request_quota, monthly_request_quota, bandwidth_limit, created_at
+		FROM users`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user := &User{}
+		var allowedTags, allowedDestinations sql.NullString
+		var expiresAt sql.NullTime
+		err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.PasswordHash,
+			&user.Enabled,
+			&allowedTags,
+			&allowedDestinations,
+			&user.RotationMode,
+			&expiresAt,
+			&user.DailyByteQuota,
+			&user.MonthlyByteQuota,
+			&user.DailyRequestQuota,
+			&user.MonthlyRequestQuota,
+			&user.BandwidthLimit,
+			&user.CreatedAt,
+		)
+		if err != nil {
+			log.Printf("Error scanning user: %v", err)
+			continue
+		}
+		fromJSON(allowedTags, &user.AllowedTags)
+		fromJSON(allowedDestinations, &user.AllowedDestinations)
+		if expiresAt.Valid {
+			user.ExpiresAt = &expiresAt.Time
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+// DeleteUser 删除入口账号及其用量记录
+func (d *Database) DeleteUser(id string) error {
+	if _, err := d.db.Exec(`DELETE FROM user_usage WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	_, err := d.db.Exec(`DELETE FROM users WHERE id = ?`, id)
+	return err
+}
+
+// SaveSource 保存订阅源
+func (d *Database) SaveSource(source *Source) error {
+	query := `INSERT OR REPLACE INTO sources
+		(id, name, url, format, enabled, refresh_interval, tags, type, username, password, proxy_username, proxy_password, headers, remove_missing, stats, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := d.db.Exec(query,
+		source.ID,
+		source.Name,
+		source.URL,
+		source.Format,
+		source.Enabled,
+		source.RefreshInterval,
+		toJSON(source.Tags),
+		source.Type,
+		source.Username,
+		source.Password,
+		source.ProxyUsername,
+		source.ProxyPassword,
+		toJSON(source.Headers),
+		source.RemoveMissing,
+		toJSON(source.Stats),
+		source.CreatedAt,
+	)
+	return err
+}
+
+// LoadSources 加载所有订阅源
+func (d *Database) LoadSources() ([]*Source, error) {
+	query := `SELECT id, name, url, format, enabled, refresh_interval, tags, type, username, password,
+		proxy_username, proxy_password, headers, remove_missing, stats, created_at
+		FROM sources`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sources []*Source
+	for rows.Next() {
+		source := &Source{}
+		var tags, headers, stats sql.NullString
+		err := rows.Scan(
+			&source.ID,
+			&source.Name,
+			&source.URL,
+			&source.Format,
+			&source.Enabled,
+			&source.RefreshInterval,
+			&tags,
+			&source.Type,
+			&source.Username,
+			&source.Password,
+			&source.ProxyUsername,
+			&source.ProxyPassword,
+			&headers,
+			&source.RemoveMissing,
+			&stats,
+			&source.CreatedAt,
+		)
+		if err != nil {
+			log.Printf("Error scanning source: %v", err)
+			continue
+		}
+		fromJSON(tags, &source.Tags)
+		fromJSON(headers, &source.Headers)
+		fromJSON(stats, &source.Stats)
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// DeleteSource 删除订阅源
+func (d *Database) DeleteSource(id string) error {
+	_, err := d.db.Exec(`DELETE FROM sources WHERE id = ?`, id)
+	return err
+}
+
+// SaveUserUsage 保存账号当日和当月用量
+func (d *Database) SaveUserUsage(usage *UserUsage) error {
+	query := `INSERT OR REPLACE INTO user_usage (user_id, period, bytes, requests) VALUES (?, ?, ?, ?)`
+
+	if _, err := d.db.Exec(query, usage.UserID, usage.Day, usage.DayBytes, usage.DayRequests); err != nil {
+		return err
+	}
+	_, err := d.db.Exec(query, usage.UserID, usage.Month, usage.MonthBytes, usage.MonthRequests)
+	return err
+}
+
+// LoadUserUsage 加载账号指定日和月的用量
+func (d *Database) LoadUserUsage(userID, day, month string) (*UserUsage, error) {
+	usage := &UserUsage{UserID: userID, Day: day, Month: month}
+
+	query := `SELECT bytes, requests FROM user_usage WHERE user_id = ? AND period = ?`
+	err := d.db.QueryRow(query, userID, day).Scan(&usage.DayBytes, &usage.DayRequests)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	err = d.db.QueryRow(query, userID, month).Scan(&usage.MonthBytes, &usage.MonthRequests)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// SaveCheck 记录一次代理检查结果
+func (d *Database) SaveCheck(proxyID string, record *CheckRecord) error {
+	query := `INSERT INTO proxy_checks (proxy_id, checked_at, success, latency, error_class, error, exit_ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := d.db.Exec(query,
+		proxyID,
+		record.CheckedAt,
+		record.Success,
+		record.Latency,
+		record.ErrorClass,
+		record.Error,
+		record.ExitIP,
+	)
+	return err
+}
+
+// LoadChecks 按时间顺序加载代理在 since 之后的检查记录
+func (d *Database) LoadChecks(proxyID string, since time.Time) ([]CheckRecord, error) {
+	query := `SELECT checked_at, success, latency, error_class, error, exit_ip
+		FROM proxy_checks WHERE proxy_id = ? AND checked_at >= ? ORDER BY checked_at`
+
+	rows, err := d.db.Query(query, proxyID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []CheckRecord
+	for rows.Next() {
+		var record CheckRecord
+		if err := rows.Scan(
+			&record.CheckedAt,
+			&record.Success,
+			&record.Latency,
+			&record.ErrorClass,
+			&record.Error,
+			&record.ExitIP,
+		); err != nil {
+			log.Printf("Error scanning proxy check: %v", err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// PruneChecks 删除 before 之前的检查记录，返回删除条数
+func (d *Database) PruneChecks(before time.Time) (int64, error) {
+	result, err := d.db.Exec(`DELETE FROM proxy_checks WHERE checked_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SaveDomainStats 在一个事务中保存域名统计
+func (d *Database) SaveDomainStats(stats []DomainStat) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT OR REPLACE INTO domain_stats
+		(proxy_id, domain, requests, successes, failures, latency_total, score, last_success, last_failure, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	for _, stat := range stats {
+		if _, err := tx.Exec(query,
+			stat.ProxyID,
+			stat.Domain,
+			stat.Requests,
+			stat.Successes,
+			stat.Failures,
+			stat.LatencyTotal,
+			stat.Score,
+			stat.LastSuccess,
+			stat.LastFailure,
+			stat.UpdatedAt,
+		); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadDomainStats 加载全部域名统计
+func (d *Database) LoadDomainStats() ([]DomainStat, error) {
+	query := `SELECT proxy_id, domain, requests, successes, failures, latency_total, score, last_success, last_failure, updated_at
+		FROM domain_stats`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []DomainStat
+	for rows.Next() {
+		var stat DomainStat
+		var lastSuccess, lastFailure, updatedAt sql.NullTime
+		if err := rows.Scan(
+			&stat.ProxyID,
+			&stat.Domain,
+			&stat.Requests,
+			&stat.Successes,
+			&stat.Failures,
+			&stat.LatencyTotal,
+			&stat.Score,
+			&lastSuccess,
+			&lastFailure,
+			&updatedAt,
+		); err != nil {
+			log.Printf("Error scanning domain stat: %v", err)
+			continue
+		}
+		stat.LastSuccess = lastSuccess.Time
+		stat.LastFailure = lastFailure.Time
+		stat.UpdatedAt = updatedAt.Time
+		stats = append(stats, stat)
+	}
+	return stats, rows.Err()
+}
+
+// PruneDomainStats 删除 before 之前没有更新的域名统计，返回删除条数
+func (d *Database) PruneDomainStats(before time.Time) (int64, error) {
+	result, err := d.db.Exec(`DELETE FROM domain_stats WHERE updated_at < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Backup 将数据库一致地复制到 path
+func (d *Database) Backup(path string) error {
+	_, err := d.db.Exec(`VACUUM INTO ?`, path)
+	return err
+}
+
 // Close 关闭数据库连接
 func (d *Database) Close() error {
 	return d.db.Close()
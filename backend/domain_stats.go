@@ -0,0 +1,328 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// domainScoreAlpha 近期成功率的指数加权系数，越大越看重最近的结果
+	domainScoreAlpha = 0.2
+	// domainScorePrior 没有记录时的中性分数
+	domainScorePrior = 0.5
+	// learnedExplore 学习路由随机选择代理的概率，使新代理也能积累记录
+	learnedExplore = 0.1
+)
+
+// DomainStat 代理访问某个目标域名的结果统计
+type DomainStat struct {
+	ProxyID      string    `json:"proxy_id"`
+	Domain       string    `json:"domain"`
+	Requests     int64     `json:"requests"`
+	Successes    int64     `json:"successes"`
+	Failures     int64     `json:"failures"`
+	SuccessRate  float64   `json:"success_rate"`
+	Score        float64   `json:"score"`
+	AvgLatency   int64     `json:"avg_latency"`
+	LatencyTotal int64     `json:"-"`
+	LastSuccess  time.Time `json:"last_success"`
+	LastFailure  time.Time `json:"last_failure"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// DomainSummary 某个目标域名在所有代理上的汇总
+type DomainSummary struct {
+	Domain      string    `json:"domain"`
+	Requests    int64     `json:"requests"`
+	Successes   int64     `json:"successes"`
+	SuccessRate float64   `json:"success_rate"`
+	Proxies     int       `json:"proxies"`
+	BestProxy   string    `json:"best_proxy"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// domainStatsState 内存中的域名统计，键为 代理ID|域名，定期写入数据库
+type domainStatsState struct {
+	mu      sync.Mutex
+	entries map[string]*DomainStat
+	dirty   map[string]bool
+}
+
+// snapshot 返回带计算字段的副本
+func (stat *DomainStat) snapshot() DomainStat {
+	s := *stat
+	if s.Requests > 0 {
+		s.SuccessRate = float64(s.Successes) / float64(s.Requests)
+	}
+	if s.Successes > 0 {
+		s.AvgLatency = s.LatencyTotal / s.Successes
+	}
+	return s
+}
+
+// record 记录一次结果，latency 为毫秒，只统计成功的请求
+func (d *domainStatsState) record(proxyID, domain string, success bool, latency int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.entries == nil {
+		d.entries = make(map[string]*DomainStat)
+		d.dirty = make(map[string]bool)
+	}
+
+	key := banKey(proxyID, domain)
+	stat, ok := d.entries[key]
+	if !ok {
+		stat = &DomainStat{ProxyID: proxyID, Domain: domain, Score: domainScorePrior}
+		d.entries[key] = stat
+	}
+
+	now := time.Now().UTC()
+	outcome := 0.0
+	stat.Requests++
+	if success {
+		outcome = 1
+		stat.Successes++
+		stat.LatencyTotal += latency
+		stat.LastSuccess = now
+	} else {
+		stat.Failures++
+		stat.LastFailure = now
+	}
+	stat.Score += domainScoreAlpha * (outcome - stat.Score)
+	stat.UpdatedAt = now
+	d.dirty[key] = true
+}
+
+// score 返回代理对域名的近期成功分数，没有记录时为中性分数
+func (d *domainStatsState) score(proxyID, domain string) float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if stat, ok := d.entries[banKey(proxyID, domain)]; ok {
+		return stat.Score
+	}
+	return domainScorePrior
+}
+
+// forDomain 返回各代理访问该域名的统计，按分数从高到低排序
+func (d *domainStatsState) forDomain(domain string) []DomainStat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := make([]DomainStat, 0)
+	for _, stat := range d.entries {
+		if stat.Domain == domain {
+			stats = append(stats, stat.snapshot())
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Score > stats[j].Score })
+	return stats
+}
+
+// summaries 按域名汇总，按请求数从多到少排序
+func (d *domainStatsState) summaries() []DomainSummary {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	byDomain := make(map[string]*DomainSummary)
+	bestScore := make(map[string]float64)
+	for _, stat := range d.entries {
+		summary, ok := byDomain[stat.Domain]
+		if !ok {
+			summary = &DomainSummary{Domain: stat.Domain}
+			byDomain[stat.Domain] = summary
+		}
+		summary.Requests += stat.Requests
+		summary.Successes += stat.Successes
+		summary.Proxies++
+		if stat.UpdatedAt.After(summary.UpdatedAt) {
+			summary.UpdatedAt = stat.UpdatedAt
+		}
+		if summary.BestProxy == "" || stat.Score > bestScore[stat.Domain] {
+			summary.BestProxy = stat.ProxyID
+			bestScore[stat.Domain] = stat.Score
+		}
+	}
+
+	summaries := make([]DomainSummary, 0, len(byDomain))
+	for _, summary := range byDomain {
+		if summary.Requests > 0 {
+			summary.SuccessRate = float64(summary.Successes) / float64(summary.Requests)
+		}
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Requests != summaries[j].Requests {
+			return summaries[i].Requests > summaries[j].Requests
+		}
+		return summaries[i].Domain < summaries[j].Domain
+	})
+	return summaries
+}
+
+// load 加载数据库中的统计
+func (d *domainStatsState) load(stats []DomainStat) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries = make(map[string]*DomainStat, len(stats))
+	d.dirty = make(map[string]bool)
+	for i := range stats {
+		d.entries[banKey(stats[i].ProxyID, stats[i].Domain)] = &stats[i]
+	}
+}
+
+// takeDirty 取出上次写入后变化的统计
+func (d *domainStatsState) takeDirty() []DomainStat {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := make([]DomainStat, 0, len(d.dirty))
+	for key := range d.dirty {
+		if stat, ok := d.entries[key]; ok {
+			stats = append(stats, *stat)
+		}
+		delete(d.dirty, key)
+	}
+	return stats
+}
+
+// forget 删除代理的全部统计
+func (d *domainStatsState) forget(proxyID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, stat := range d.entries {
+		if stat.ProxyID == proxyID {
+			delete(d.entries, key)
+			delete(d.dirty, key)
+		}
+	}
+}
+
+// prune 删除 before 之前没有更新的统计
+func (d *domainStatsState) prune(before time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, stat := range d.entries {
+		if stat.UpdatedAt.Before(before) {
+			delete(d.entries, key)
+			delete(d.dirty, key)
+		}
+	}
+}
+
+// recordOutcome 记录代理访问目标域名的结果
+func (p *ProxyPool) recordOutcome(proxy *Proxy, host string, success bool, latency time.Duration) {
+	if host == "" {
+		return
+	}
+	p.domains.record(proxy.ID, host, success, latency.Milliseconds())
+}
+
+// recordTunnel 记录隧道结果：目标返回了数据视为成功，返回数据前被关闭或重置视为失败，
+// 其他情况 (如客户端未发送数据即断开) 不计入
+func (p *ProxyPool) recordTunnel(proxy *Proxy, host string, latency time.Duration, downstream int64, err error) {
+	switch {
+	case downstream > 0:
+		p.recordOutcome(proxy, host, true, latency)
+	case isHandshakeReset(err):
+		p.recordOutcome(proxy, host, false, latency)
+	}
+}
+
+// statusFailed 判断响应状态码是否说明请求没有成功到达目标 (被拒绝、限流或代理出错)
+func statusFailed(code int) bool {
+	return code == http.StatusForbidden || code == http.StatusProxyAuthRequired ||
+		code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// selectLearned 选择对目标域名近期成功分数最高的代理，分数相同时随机选择。
+// 没有记录的代理按中性分数参与，并以小概率随机选择以便积累记录。
+func (p *ProxyPool) selectLearned(candidates []*Proxy, host string) *Proxy {
+	if host == "" || rand.Float64() < learnedExplore {
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	var best []*Proxy
+	bestScore := -1.0
+	for _, proxy := range candidates {
+		score := p.domains.score(proxy.ID, host)
+		switch {
+		case score > bestScore:
+			best = append(best[:0], proxy)
+			bestScore = score
+		case score == bestScore:
+			best = append(best, proxy)
+		}
+	}
+	return best[rand.Intn(len(best))]
+}
+
+// LoadDomainStats 从数据库加载域名统计
+func (p *ProxyPool) LoadDomainStats() error {
+	if p.db == nil {
+		return nil
+	}
+	stats, err := p.db.LoadDomainStats()
+	if err != nil {
+		return err
+	}
+	p.domains.load(stats)
+	return nil
+}
+
+// FlushDomainStats 将变化的域名统计写入数据库
+func (p *ProxyPool) FlushDomainStats() {
+	if p.db == nil {
+		return
+	}
+
+	stats := p.domains.takeDirty()
+	if len(stats) == 0 {
+		return
+	}
+	if err := p.db.SaveDomainStats(stats); err != nil {
+		log.Printf("Failed to save domain stats: %v", err)
+	}
+}
+
+// GetDomainsHandler 按目标域名汇总访问结果，?limit= 限制返回条数 (默认 100)
+func (p *ProxyPool) GetDomainsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	summaries := p.domains.summaries()
+	total := len(summaries)
+	if len(summaries) > limit {
+		summaries = summaries[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"domains": summaries,
+		"total":   total,
+	})
+}
+
+// GetDomainHandler 返回各代理访问指定域名的统计
+func (p *ProxyPool) GetDomainHandler(c *gin.Context) {
+	domain := normalizeHost(c.Param("domain"))
+	stats := p.domains.forDomain(domain)
+
+	c.JSON(http.StatusOK, gin.H{
+		"domain":  domain,
+		"proxies": stats,
+	})
+}
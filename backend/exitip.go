@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// detectExitIP 通过代理请求 IP 回显地址，返回代理的出口 IP。
+// 支持纯文本和带 ip/origin 字段的 JSON 响应。
+func detectExitIP(client *http.Client, echoURL string) (string, error) {
+	resp, err := client.Get(echoURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("ip echo returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+
+	text := strings.TrimSpace(string(body))
+	var fields struct {
+		IP     string `json:"ip"`
+		Origin string `json:"origin"`
+	}
+	if json.Unmarshal(body, &fields) == nil {
+		text = fields.IP
+		if text == "" {
+			// httpbin 格式可能为 "a, b"
+			text = strings.TrimSpace(strings.Split(fields.Origin, ",")[0])
+		}
+	}
+
+	ip := net.ParseIP(text)
+	if ip == nil {
+		return "", fmt.Errorf("ip echo returned invalid address %q", text)
+	}
+	return ip.String(), nil
+}
+
+// collapseExits 每个出口 IP 只保留响应最快的一个代理，未知出口的代理保持不变
+func collapseExits(proxies []*Proxy) []*Proxy {
+	best := make(map[string]*Proxy)
+	for _, proxy := range proxies {
+		if proxy.ExitIP == "" {
+			continue
+		}
+		current, ok := best[proxy.ExitIP]
+		if !ok || proxy.ResponseTime < current.ResponseTime ||
+			(proxy.ResponseTime == current.ResponseTime && proxy.ID < current.ID) {
+			best[proxy.ExitIP] = proxy
+		}
+	}
+
+	collapsed := make([]*Proxy, 0, len(proxies))
+	for _, proxy := range proxies {
+		if proxy.ExitIP == "" || best[proxy.ExitIP] == proxy {
+			collapsed = append(collapsed, proxy)
+		}
+	}
+	return collapsed
+}
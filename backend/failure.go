@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrorClass 代理失败原因分类
+type ErrorClass string
+
+const (
+	ErrorNone           ErrorClass = ""
+	ErrorDNS            ErrorClass = "dns"
+	ErrorRefused        ErrorClass = "refused"
+	ErrorTimeout        ErrorClass = "timeout"
+	ErrorTLS            ErrorClass = "tls"
+	ErrorTLSIntercepted ErrorClass = "tls_intercepted"
+	ErrorProxyAuth      ErrorClass = "proxy_auth"
+	ErrorBadStatus      ErrorClass = "bad_status"
+	ErrorBodyAssertion  ErrorClass = "body_assertion"
+	ErrorTooSlow        ErrorClass = "too_slow"
+	ErrorProtocol       ErrorClass = "protocol"
+	ErrorOther          ErrorClass = "other"
+)
+
+var (
+	errProxyAuth  = errors.New("proxy authentication required")
+	errNoProtocol = errors.New("no supported protocol detected")
+)
+
+// classifyError 将验证或转发中的错误归类
+func classifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorNone
+	}
+
+	switch {
+	case errors.Is(err, errProxyAuth):
+		return ErrorProxyAuth
+	case errors.Is(err, errBodyAssertion):
+		return ErrorBodyAssertion
+	case errors.Is(err, errBadStatus):
+		return ErrorBadStatus
+	case errors.Is(err, errTooSlow), errors.Is(err, errLowThroughput):
+		return ErrorTooSlow
+	case errors.Is(err, errTLSIntercepted):
+		return ErrorTLSIntercepted
+	case errors.Is(err, errNoProtocol):
+		return ErrorProtocol
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ErrorDNS
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return ErrorRefused
+	}
+	if isTLSError(err) {
+		return ErrorTLS
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return ErrorTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorTimeout
+	}
+
+	// 部分库只返回文本错误
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "Proxy Authentication Required"),
+		strings.Contains(msg, "authentication failed"):
+		return ErrorProxyAuth
+	case strings.Contains(msg, "Client.Timeout exceeded"):
+		return ErrorTimeout
+	case strings.Contains(msg, "tls: "), strings.Contains(msg, "x509: "):
+		return ErrorTLS
+	}
+	return ErrorOther
+}
+
+// isTLSError 判断是否为 TLS 握手或证书错误
+func isTLSError(err error) bool {
+	var recordErr tls.RecordHeaderError
+	var verifyErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	return errors.As(err, &recordErr) || errors.As(err, &verifyErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr)
+}
+
+// setLastError 记录代理最近一次失败的原因，调用方需持有写锁
+func (proxy *Proxy) setLastError(err error) {
+	proxy.LastErrorClass = classifyError(err)
+	proxy.LastError = err.Error()
+	proxy.LastErrorAt = time.Now()
+}
+
+// clearLastError 检查通过后清除失败原因，调用方需持有写锁
+func (proxy *Proxy) clearLastError() {
+	proxy.LastErrorClass = ErrorNone
+	proxy.LastError = ""
+	proxy.LastErrorAt = time.Time{}
+}
+
+// recordFailure 记录转发流量时遇到的代理错误
+func (p *ProxyPool) recordFailure(proxy *Proxy, err error) {
+	p.mu.Lock()
+	proxy.setLastError(err)
+	p.mu.Unlock()
+
+	log.Printf("Proxy %s:%d request failed (%s): %v", proxy.Address, proxy.Port, classifyError(err), err)
+}
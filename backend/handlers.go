@@ -1,9 +1,10 @@
 package main
 
 import (
-	"math/rand"
+	"fmt"
 	"net/http"
-	"sync/atomic"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -17,8 +18,12 @@ func (p *ProxyPool) AddProxy(proxy *Proxy) error {
 	if proxy.ID == "" {
 		proxy.ID = uuid.New().String()
 	}
+	if proxy.Type == "" {
+		proxy.Type = Auto
+	}
 	proxy.CreatedAt = time.Now()
 	proxy.Status = StatusInactive
+	proxy.UsageMonth = usageMonth(proxy.CreatedAt)
 
 	p.proxies[proxy.ID] = proxy
 
@@ -38,6 +43,7 @@ func (p *ProxyPool) RemoveProxy(id string) error {
 
 	delete(p.proxies, id)
 	p.rebuildActiveProxies()
+	p.domains.forget(id)
 
 	// 从数据库删除
 	if p.db != nil {
@@ -49,36 +55,6 @@ func (p *ProxyPool) RemoveProxy(id string) error {
 	return nil
 }
 
-func (p *ProxyPool) GetNextProxy() *Proxy {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-
-	if len(p.activeProxies) == 0 {
-		return nil
-	}
-
-	switch p.config.RotationMode {
-	case Sequential:
-		idx := atomic.AddUint32(&p.currentIndex, 1)
-		return p.activeProxies[int(idx)%len(p.activeProxies)]
-	case Random:
-		return p.activeProxies[rand.Intn(len(p.activeProxies))]
-	case LeastUsed:
-		var minProxy *Proxy
-		var minCount int64 = -1
-		for _, proxy := range p.activeProxies {
-			count := proxy.SuccessCount + proxy.FailCount
-			if minCount == -1 || count < minCount {
-				minCount = count
-				minProxy = proxy
-			}
-		}
-		return minProxy
-	}
-
-	return p.activeProxies[0]
-}
-
 func (p *ProxyPool) rebuildActiveProxies() {
 	p.activeProxies = make([]*Proxy, 0)
 	for _, proxy := range p.proxies {
@@ -92,8 +68,29 @@ func (p *ProxyPool) GetProxiesHandler(c *gin.Context) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
+	anonymity := AnonymityLevel(c.Query("anonymity"))
+	exitIP := c.Query("exit_ip")
+	errorClass := ErrorClass(c.Query("error_class"))
+	profile := c.Query("profile")
+	source := c.Query("source")
+
 	proxies := make([]*Proxy, 0, len(p.proxies))
 	for _, proxy := range p.proxies {
+		if anonymity != AnonymityUnknown && proxy.Anonymity != anonymity {
+			continue
+		}
+		if exitIP != "" && proxy.ExitIP != exitIP {
+			continue
+		}
+		if errorClass != ErrorNone && proxy.LastErrorClass != errorClass {
+			continue
+		}
+		if profile != "" && proxy.ProfileHealth[profile].Status != StatusActive {
+			continue
+		}
+		if source != "" && proxy.SourceID != source {
+			continue
+		}
 		proxies = append(proxies, proxy)
 	}
 
@@ -110,12 +107,19 @@ func (p *ProxyPool) AddProxyHandler(c *gin.Context) {
 		return
 	}
 
+	country, ok := normalizeCountry(proxy.Country)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "country must be a two-letter code"})
+		return
+	}
+	proxy.Country = country
+
 	if err := p.AddProxy(&proxy); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	go p.validateProxy(&proxy)
+	p.validation.Enqueue(&proxy, priorityHigh)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Proxy added successfully",
@@ -133,3 +137,144 @@ func (p *ProxyPool) DeleteProxyHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Proxy deleted successfully"})
 }
+
+// UpdateProxyHandler 更新代理的标签和流量上限
+func (p *ProxyPool) UpdateProxyHandler(c *gin.Context) {
+	var req struct {
+		Tags           *[]string `json:"tags"`
+		MonthlyDataCap *int64    `json:"monthly_data_cap"`
+		Country        *string   `json:"country"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.MonthlyDataCap != nil && *req.MonthlyDataCap < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "monthly_data_cap must not be negative"})
+		return
+	}
+	if req.Country != nil {
+		country, ok := normalizeCountry(*req.Country)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "country must be a two-letter code"})
+			return
+		}
+		req.Country = &country
+	}
+
+	p.mu.Lock()
+	proxy, ok := p.proxies[c.Param("id")]
+	if !ok {
+		p.mu.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proxy not found"})
+		return
+	}
+	if req.Tags != nil {
+		proxy.Tags = *req.Tags
+	}
+	if req.MonthlyDataCap != nil {
+		proxy.MonthlyDataCap = *req.MonthlyDataCap
+	}
+	if req.Country != nil {
+		proxy.Country = *req.Country
+	}
+	snapshot := *proxy
+	p.mu.Unlock()
+
+	if p.db != nil {
+		if err := p.db.SaveProxy(&snapshot); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Proxy updated successfully",
+		"proxy":   snapshot,
+	})
+}
+
+// ResetProxyUsageHandler 清零代理的月流量，使达到上限的代理重新参与轮换
+func (p *ProxyPool) ResetProxyUsageHandler(c *gin.Context) {
+	proxy, ok := p.ResetProxyUsage(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proxy not found"})
+		return
+	}
+
+	p.FlushProxyUsage()
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Proxy usage reset successfully",
+		"proxy":   proxy,
+	})
+}
+
+// GetProxyHistoryHandler 返回代理在时间窗口内的检查记录、在线率和延迟分位数
+func (p *ProxyPool) GetProxyHistoryHandler(c *gin.Context) {
+	id := c.Param("id")
+
+	p.mu.RLock()
+	_, exists := p.proxies[id]
+	p.mu.RUnlock()
+
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Proxy not found"})
+		return
+	}
+	if p.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "History requires a database"})
+		return
+	}
+
+	window, err := parseWindow(c.DefaultQuery("window", "24h"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+
+	records, err := p.db.LoadChecks(id, time.Now().UTC().Add(-window))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load history"})
+		return
+	}
+
+	summary := summarizeChecks(records)
+	if len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"proxy_id": id,
+		"window":   window.String(),
+		"summary":  summary,
+		"checks":   records,
+	})
+}
+
+// parseWindow 解析时间窗口，支持 Go 时长格式和以 d 结尾的天数
+func parseWindow(value string) (time.Duration, error) {
+	var window time.Duration
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", value)
+		}
+		window = d
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("window must be positive")
+	}
+	return window, nil
+}
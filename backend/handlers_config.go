@@ -1,66 +1,35 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func (p *ProxyPool) ImportProxiesHandler(c *gin.Context) {
-	var req struct {
-		Proxies []struct {
-			Address  string    `json:"address"`
-			Port     int       `json:"port"`
-			Type     ProxyType `json:"type"`
-			Username string    `json:"username,omitempty"`
-			Password string    `json:"password,omitempty"`
-		} `json:"proxies"`
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+func (p *ProxyPool) ValidateProxiesHandler(c *gin.Context) {
+	p.mu.RLock()
+	proxies := make([]*Proxy, 0, len(p.proxies))
+	for _, proxy := range p.proxies {
+		proxies = append(proxies, proxy)
 	}
+	p.mu.RUnlock()
 
-	added := 0
-	for _, proxyData := range req.Proxies {
-		proxy := &Proxy{
-			Address:  proxyData.Address,
-			Port:     proxyData.Port,
-			Type:     proxyData.Type,
-			Username: proxyData.Username,
-			Password: proxyData.Password,
-		}
-		if err := p.AddProxy(proxy); err == nil {
-			added++
-			go p.validateProxy(proxy)
+	queued := 0
+	for _, proxy := range proxies {
+		if p.validation.Enqueue(proxy, priorityNormal) {
+			queued++
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Proxies imported successfully",
-		"added":   added,
+		"message": "Validation started",
+		"queued":  queued,
 	})
 }
 
-func (p *ProxyPool) ValidateProxiesHandler(c *gin.Context) {
-	go func() {
-		p.mu.RLock()
-		proxies := make([]*Proxy, 0, len(p.proxies))
-		for _, proxy := range p.proxies {
-			proxies = append(proxies, proxy)
-		}
-		p.mu.RUnlock()
-
-		for _, proxy := range proxies {
-			p.validateProxy(proxy)
-		}
-	}()
-
-	c.JSON(http.StatusOK, gin.H{"message": "Validation started"})
-}
-
 func (p *ProxyPool) GetConfigHandler(c *gin.Context) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
@@ -74,11 +43,72 @@ func (p *ProxyPool) UpdateConfigHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := newConfig.DestinationACL.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := newConfig.HTTPClientACL.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := newConfig.SOCKS5ClientACL.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !newConfig.MinAnonymity.valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid min_anonymity"})
+		return
+	}
+	if err := validateHealthChecks(newConfig.HealthChecks, newConfig.HealthCheckQuorum); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateHealthProfiles(newConfig.HealthProfiles); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := p.jobs.Validate(newConfig.Jobs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if newConfig.BackupRetention < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "backup_retention must not be negative"})
+		return
+	}
+	if newConfig.ShutdownTimeout < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "shutdown_timeout must not be negative"})
+		return
+	}
+	if err := validateBanRules(newConfig.BanRules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if newConfig.ValidationWorkers < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validation_workers must not be negative"})
+		return
+	}
+	if newConfig.ThroughputBytes < 0 || newConfig.MinThroughput < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "throughput_bytes and min_throughput must not be negative"})
+		return
+	}
+	if newConfig.HistoryRetentionDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "history_retention_days must not be negative"})
+		return
+	}
+	for _, port := range newConfig.CapabilityPorts {
+		if port < 1 || port > 65535 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid capability port %d", port)})
+			return
+		}
+	}
 
 	p.mu.Lock()
 	p.config = newConfig
 	p.mu.Unlock()
 
+	p.validation.SetWorkers(newConfig.ValidationWorkers)
+	p.jobs.Apply(newConfig.Jobs)
+
 	// 保存到数据库
 	if p.db != nil {
 		if err := p.db.SaveConfig(&newConfig); err != nil {
@@ -103,6 +133,9 @@ func (p *ProxyPool) GetStatsHandler(c *gin.Context) {
 		TotalRequests:   p.stats.TotalRequests,
 		SuccessRequests: p.stats.SuccessRequests,
 		FailedRequests:  p.stats.FailedRequests,
+		RejectedClients: atomic.LoadInt64(&p.stats.RejectedClients),
+		AuthFailures:    atomic.LoadInt64(&p.stats.AuthFailures),
+		ValidationQueue: p.validation.Len(),
 	}
 
 	c.JSON(http.StatusOK, stats)
@@ -126,6 +159,9 @@ func (p *ProxyPool) GetRealtimeStatsHandler(c *gin.Context) {
 				TotalRequests:   p.stats.TotalRequests,
 				SuccessRequests: p.stats.SuccessRequests,
 				FailedRequests:  p.stats.FailedRequests,
+				RejectedClients: atomic.LoadInt64(&p.stats.RejectedClients),
+				AuthFailures:    atomic.LoadInt64(&p.stats.AuthFailures),
+				ValidationQueue: p.validation.Len(),
 			}
 			p.mu.RUnlock()
 
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// exportFormats 导出格式对应的 Content-Type 和文件扩展名
+var exportFormats = map[string]struct{ contentType, ext string }{
+	"txt":   {"text/plain; charset=utf-8", "txt"},
+	"csv":   {"text/csv; charset=utf-8", "csv"},
+	"json":  {"application/json; charset=utf-8", "json"},
+	"clash": {"application/yaml; charset=utf-8", "yaml"},
+	"curl":  {"text/plain; charset=utf-8", "sh"},
+	"env":   {"text/plain; charset=utf-8", "env"},
+}
+
+// exportOptions 导出的筛选条件和输出选项
+type exportOptions struct {
+	status      ProxyStatus
+	tags        []string
+	countries   map[string]bool
+	maxLatency  int64
+	credentials bool
+	target      string
+}
+
+// exportProxy 导出的单个代理，credentials 未开启时不带用户名和密码
+type exportProxy struct {
+	Address      string         `json:"address"`
+	Port         int            `json:"port"`
+	Type         ProxyType      `json:"type"`
+	Username     string         `json:"username,omitempty"`
+	Password     string         `json:"password,omitempty"`
+	URL          string         `json:"url"`
+	Country      string         `json:"country"`
+	Tags         []string       `json:"tags"`
+	ResponseTime int64          `json:"response_time"`
+	Anonymity    AnonymityLevel `json:"anonymity"`
+	ExitIP       string         `json:"exit_ip"`
+}
+
+// clashExportProxy Clash proxy-provider 中的代理条目
+type clashExportProxy struct {
+	Name     string `yaml:"name"`
+	Type     string `yaml:"type"`
+	Server   string `yaml:"server"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	TLS      bool   `yaml:"tls,omitempty"`
+}
+
+// splitList 拆分逗号分隔的参数
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseExportOptions 读取导出的查询参数
+func (p *ProxyPool) parseExportOptions(c *gin.Context) (*exportOptions, error) {
+	opts := &exportOptions{
+		status:      ProxyStatus(c.DefaultQuery("status", string(StatusActive))),
+		tags:        splitList(c.Query("tags")),
+		credentials: c.Query("credentials") == "true",
+		target:      c.Query("url"),
+	}
+
+	switch opts.status {
+	case StatusActive, StatusInactive, StatusChecking, "all":
+	default:
+		return nil, fmt.Errorf("status must be active, inactive, checking or all")
+	}
+
+	for _, code := range splitList(c.Query("country")) {
+		country, ok := normalizeCountry(code)
+		if !ok {
+			return nil, fmt.Errorf("invalid country %q", code)
+		}
+		if opts.countries == nil {
+			opts.countries = make(map[string]bool)
+		}
+		opts.countries[country] = true
+	}
+
+	if raw := c.Query("max_latency"); raw != "" {
+		maxLatency, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxLatency <= 0 {
+			return nil, fmt.Errorf("max_latency must be a positive number of milliseconds")
+		}
+		opts.maxLatency = maxLatency
+	}
+
+	if opts.target == "" {
+		p.mu.RLock()
+		opts.target = p.config.HealthCheckURL
+		p.mu.RUnlock()
+	}
+	return opts, nil
+}
+
+// exportScheme 代理 URL 使用的 scheme，未识别协议的代理按探测到的第一个协议处理。
+// HTTPS 类型与 HTTP 一样是明文 CONNECT 代理，只有 TLS 为 true 时才用 https
+func exportScheme(proxy *Proxy) string {
+	proxyType := proxy.Type
+	if proxyType == Auto && len(proxy.Protocols) > 0 {
+		proxyType = proxy.Protocols[0]
+	}
+	switch proxyType {
+	case SOCKS5:
+		return "socks5"
+	case SOCKS4:
+		return "socks4"
+	}
+	if proxy.TLS {
+		return "https"
+	}
+	return "http"
+}
+
+// collectExport 按条件筛选代理，按响应时间从快到慢排序
+func (p *ProxyPool) collectExport(opts *exportOptions) []exportProxy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var proxies []exportProxy
+	for _, proxy := range p.proxies {
+		if opts.status != "all" && proxy.Status != opts.status {
+			continue
+		}
+		if len(opts.tags) > 0 && !proxy.hasAnyTag(opts.tags) {
+			continue
+		}
+		if opts.countries != nil && !opts.countries[proxy.Country] {
+			continue
+		}
+		if opts.maxLatency > 0 && proxy.ResponseTime > opts.maxLatency {
+			continue
+		}
+
+		entry := exportProxy{
+			Address:      proxy.Address,
+			Port:         proxy.Port,
+			Type:         proxy.Type,
+			Country:      proxy.Country,
+			Tags:         proxy.Tags,
+			ResponseTime: proxy.ResponseTime,
+			Anonymity:    proxy.Anonymity,
+			ExitIP:       proxy.ExitIP,
+		}
+		u := url.URL{Scheme: exportScheme(proxy), Host: net.JoinHostPort(proxy.Address, strconv.Itoa(proxy.Port))}
+		if opts.credentials && proxy.Username != "" {
+			entry.Username = proxy.Username
+			entry.Password = proxy.Password
+			u.User = url.UserPassword(proxy.Username, proxy.Password)
+		}
+		entry.URL = u.String()
+		proxies = append(proxies, entry)
+	}
+
+	// 未测出响应时间的代理排在最后
+	sort.Slice(proxies, func(i, j int) bool {
+		if (proxies[i].ResponseTime == 0) != (proxies[j].ResponseTime == 0) {
+			return proxies[j].ResponseTime == 0
+		}
+		if proxies[i].ResponseTime != proxies[j].ResponseTime {
+			return proxies[i].ResponseTime < proxies[j].ResponseTime
+		}
+		return proxies[i].URL < proxies[j].URL
+	})
+	return proxies
+}
+
+// renderExport 按格式输出代理列表
+func renderExport(format string, proxies []exportProxy, opts *exportOptions) ([]byte, error) {
+	var buf bytes.Buffer
+
+	switch format {
+	case "json":
+		if proxies == nil {
+			proxies = []exportProxy{}
+		}
+		encoder := json.NewEncoder(&buf)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(proxies); err != nil {
+			return nil, err
+		}
+
+	case "csv":
+		w := csv.NewWriter(&buf)
+		// url 列带有 scheme，重新导入时保留 TLS 等类型列无法表达的信息
+		header := []string{"address", "port", "type", "url"}
+		if opts.credentials {
+			header = append(header, "username", "password")
+		}
+		header = append(header, "country", "tags", "response_time", "anonymity", "exit_ip")
+		w.Write(header)
+		for _, proxy := range proxies {
+			record := []string{proxy.Address, strconv.Itoa(proxy.Port), string(proxy.Type), proxy.URL}
+			if opts.credentials {
+				record = append(record, proxy.Username, proxy.Password)
+			}
+			record = append(record,
+				proxy.Country,
+				strings.Join(proxy.Tags, ";"),
+				strconv.FormatInt(proxy.ResponseTime, 10),
+				string(proxy.Anonymity),
+				proxy.ExitIP,
+			)
+			w.Write(record)
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+
+	case "clash":
+		provider := struct {
+			Proxies []clashExportProxy `yaml:"proxies"`
+		}{Proxies: []clashExportProxy{}}
+		for _, proxy := range proxies {
+			scheme := strings.SplitN(proxy.URL, "://", 2)[0]
+			item := clashExportProxy{
+				Name:     net.JoinHostPort(proxy.Address, strconv.Itoa(proxy.Port)),
+				Server:   proxy.Address,
+				Port:     proxy.Port,
+				Username: proxy.Username,
+				Password: proxy.Password,
+			}
+			switch scheme {
+			case "socks5":
+				item.Type = "socks5"
+			case "http", "https":
+				item.Type = "http"
+				item.TLS = scheme == "https"
+			default:
+				// Clash 不支持 SOCKS4
+				continue
+			}
+			provider.Proxies = append(provider.Proxies, item)
+		}
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(provider); err != nil {
+			return nil, err
+		}
+
+	case "curl":
+		for _, proxy := range proxies {
+			fmt.Fprintf(&buf, "curl -x %s %s\n", shellQuote(curlProxyURL(proxy.URL)), shellQuote(opts.target))
+		}
+
+	case "env":
+		for i, proxy := range proxies {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			fmt.Fprintf(&buf, "# %s\n", net.JoinHostPort(proxy.Address, strconv.Itoa(proxy.Port)))
+			value := shellQuote(curlProxyURL(proxy.URL))
+			if strings.HasPrefix(proxy.URL, "socks") {
+				fmt.Fprintf(&buf, "export ALL_PROXY=%s all_proxy=%s\n", value, value)
+				continue
+			}
+			fmt.Fprintf(&buf, "export HTTP_PROXY=%s HTTPS_PROXY=%s http_proxy=%s https_proxy=%s\n", value, value, value, value)
+		}
+
+	default:
+		for _, proxy := range proxies {
+			buf.WriteString(proxy.URL)
+			buf.WriteString("\n")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// curlProxyURL SOCKS 代理改用 socks5h/socks4a，让代理端解析目标域名
+func curlProxyURL(proxyURL string) string {
+	switch {
+	case strings.HasPrefix(proxyURL, "socks5://"):
+		return "socks5h://" + strings.TrimPrefix(proxyURL, "socks5://")
+	case strings.HasPrefix(proxyURL, "socks4://"):
+		return "socks4a://" + strings.TrimPrefix(proxyURL, "socks4://")
+	}
+	return proxyURL
+}
+
+// shellQuote 用单引号包裹参数，供导出的 shell 片段使用
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// ExportProxiesHandler 按条件导出代理，格式为 txt、csv、json、clash、curl 或 env
+func (p *ProxyPool) ExportProxiesHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", "txt")
+	meta, ok := exportFormats[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported format %q", format)})
+		return
+	}
+
+	opts, err := p.parseExportOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	proxies := p.collectExport(opts)
+	body, err := renderExport(format, proxies, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("download") == "true" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="proxies.%s"`, meta.ext))
+	}
+	c.Header("X-Proxy-Count", strconv.Itoa(len(proxies)))
+	c.Data(http.StatusOK, meta.contentType, body)
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestExportCSVRoundTrip(t *testing.T) {
+	p := NewProxyPool()
+	for _, proxy := range []*Proxy{
+		{Address: "1.2.3.4", Port: 443, Type: HTTP, TLS: true, Status: StatusActive, Country: "US", Tags: []string{"a", "b"}, Username: "u", Password: "p,w"},
+		{Address: "5.6.7.8", Port: 8080, Type: HTTP, Status: StatusActive},
+		{Address: "9.9.9.9", Port: 1080, Type: SOCKS5, Status: StatusActive},
+	} {
+		if err := p.AddProxy(proxy); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, credentials := range []bool{false, true} {
+		opts := &exportOptions{status: "all", credentials: credentials}
+		data, err := renderExport("csv", p.collectExport(opts), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries, errs := parseCSVList(data, nil)
+		if len(errs) != 0 || len(entries) != 3 {
+			t.Fatalf("credentials=%v: re-import gave %d entries, errors %v\n%s", credentials, len(entries), errs, data)
+		}
+		imported := make(map[string]*Proxy)
+		for _, entry := range entries {
+			imported[proxyKey(entry.proxy.Address, entry.proxy.Port)] = entry.proxy
+		}
+
+		tls := imported["1.2.3.4:443"]
+		if tls == nil || tls.Type != HTTP || !tls.TLS || tls.Country != "US" || len(tls.Tags) != 2 {
+			t.Errorf("credentials=%v: TLS proxy re-imported as %+v", credentials, tls)
+		}
+		if credentials && (tls.Username != "u" || tls.Password != "p,w") {
+			t.Errorf("credentials lost: %q %q", tls.Username, tls.Password)
+		}
+		if !credentials && tls.Username != "" {
+			t.Errorf("credentials exported without credentials=true")
+		}
+		if plain := imported["5.6.7.8:8080"]; plain == nil || plain.TLS {
+			t.Errorf("plain HTTP proxy re-imported as %+v", plain)
+		}
+		if socks := imported["9.9.9.9:1080"]; socks == nil || socks.Type != SOCKS5 {
+			t.Errorf("SOCKS5 proxy re-imported as %+v", socks)
+		}
+	}
+}
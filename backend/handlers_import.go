@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize 导入列表的最大字节数
+const maxImportSize = 10 << 20
+
+// importRequest 导入参数。JSON 请求体中 proxies 为代理对象或代理 URL 数组，
+// data 为任意格式的列表文本；原始请求体和文件上传时列表即请求体或文件内容
+type importRequest struct {
+	Proxies json.RawMessage   `json:"proxies"`
+	Data    string            `json:"data"`
+	Format  ListFormat        `json:"format"`
+	Type    ProxyType         `json:"type"`
+	Tags    []string          `json:"tags"`
+	Columns map[string]string `json:"columns"`
+}
+
+// importReportLine 导入报告中的一个条目，status 为 added、duplicate 或 rejected
+type importReportLine struct {
+	Line   int    `json:"line"`
+	Input  string `json:"input"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	ID     string `json:"id,omitempty"`
+}
+
+// readImportRequest 从 JSON 请求体、multipart 文件 (字段 file) 或原始请求体读取导入参数和列表内容
+func readImportRequest(c *gin.Context) (*importRequest, []byte, error) {
+	req := &importRequest{}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	switch c.ContentType() {
+	case "application/json":
+		if err := c.ShouldBindJSON(req); err != nil {
+			return nil, nil, err
+		}
+		if len(req.Proxies) > 0 && string(req.Proxies) != "null" {
+			req.Format = FormatJSON
+			return req, req.Proxies, nil
+		}
+		return req, []byte(req.Data), nil
+
+	case "multipart/form-data":
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, nil, fmt.Errorf("file is required: %w", err)
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := readImportOptions(req, c.PostForm); err != nil {
+			return nil, nil, err
+		}
+		return req, data, nil
+
+	default:
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := readImportOptions(req, c.Query); err != nil {
+			return nil, nil, err
+		}
+		return req, data, nil
+	}
+}
+
+// readImportOptions 读取表单字段或查询参数中的导入选项，tags 以逗号分隔，columns 为 JSON 对象
+func readImportOptions(req *importRequest, value func(string) string) error {
+	req.Format = ListFormat(value("format"))
+	req.Type = ProxyType(value("type"))
+	for _, tag := range strings.Split(value("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			req.Tags = append(req.Tags, tag)
+		}
+	}
+	if columns := value("columns"); columns != "" {
+		if err := json.Unmarshal([]byte(columns), &req.Columns); err != nil {
+			return fmt.Errorf("columns must be a JSON object: %w", err)
+		}
+	}
+	return nil
+}
+
+// ImportProxiesHandler 批量导入代理，支持文本、JSON、CSV、Clash YAML 和 base64 列表，
+// 返回每个条目的处理结果
+func (p *ProxyPool) ImportProxiesHandler(c *gin.Context) {
+	req, data, err := readImportRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "proxy list is empty"})
+		return
+	}
+
+	format := req.Format
+	if format == "" {
+		format = FormatAuto
+	}
+	if !format.valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported format %q", format)})
+		return
+	}
+	if req.Type != "" && !validListType(req.Type) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported proxy type %q", req.Type)})
+		return
+	}
+	// 给出列映射时按 CSV 解析
+	if format == FormatAuto && len(req.Columns) > 0 {
+		format = FormatCSV
+	}
+	if format == FormatAuto {
+		format = detectListFormat(data)
+	}
+
+	var entries []listEntry
+	var rejected []listError
+	if format == FormatCSV {
+		entries, rejected = parseCSVList(data, req.Columns)
+	} else {
+		entries, rejected = parseProxyList(data, format)
+	}
+
+	p.mu.RLock()
+	existing := make(map[string]bool, len(p.proxies))
+	for _, proxy := range p.proxies {
+		existing[proxyKey(proxy.Address, proxy.Port)] = true
+	}
+	p.mu.RUnlock()
+
+	report := make([]importReportLine, 0, len(entries)+len(rejected))
+	for _, invalid := range rejected {
+		report = append(report, importReportLine{Line: invalid.Line, Input: invalid.Input, Status: "rejected", Error: invalid.Error})
+	}
+
+	added, duplicates, failed := 0, 0, len(rejected)
+	listed := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		key := proxyKey(entry.proxy.Address, entry.proxy.Port)
+		line := importReportLine{Line: entry.line, Input: entry.input}
+
+		switch first, seen := listed[key]; {
+		case existing[key]:
+			line.Status = "duplicate"
+			line.Error = "already in the pool"
+			duplicates++
+		case seen:
+			line.Status = "duplicate"
+			line.Error = fmt.Sprintf("same proxy as line %d", first)
+			duplicates++
+		default:
+			listed[key] = entry.line
+			proxy := entry.proxy
+			applyListDefaults(proxy, req.Type, req.Tags)
+			if err := p.AddProxy(proxy); err != nil {
+				line.Status = "rejected"
+				line.Error = err.Error()
+				failed++
+				break
+			}
+			p.validation.Enqueue(proxy, priorityHigh)
+			line.Status = "added"
+			line.ID = proxy.ID
+			added++
+		}
+		report = append(report, line)
+	}
+	sort.SliceStable(report, func(i, j int) bool { return report[i].Line < report[j].Line })
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Proxies imported successfully",
+		"format":     format,
+		"added":      added,
+		"duplicates": duplicates,
+		"rejected":   failed,
+		"report":     report,
+	})
+}
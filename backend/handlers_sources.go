@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (p *ProxyPool) GetSourcesHandler(c *gin.Context) {
+	sources := p.sources.List()
+	counts := p.sourceProxyCounts()
+	for i := range sources {
+		sources[i].Stats.Proxies = counts[sources[i].ID]
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].CreatedAt.Before(sources[j].CreatedAt) })
+
+	c.JSON(http.StatusOK, gin.H{
+		"sources": sources,
+		"total":   len(sources),
+	})
+}
+
+// CreateSourceHandler 创建订阅源，启用时立即在后台拉取一次
+func (p *ProxyPool) CreateSourceHandler(c *gin.Context) {
+	var source Source
+	if err := c.ShouldBindJSON(&source); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := p.sources.Create(&source); err != nil {
+		c.JSON(sourceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if source.Enabled {
+		go p.RefreshSource(source.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Source created successfully",
+		"source":  source,
+	})
+}
+
+func (p *ProxyPool) UpdateSourceHandler(c *gin.Context) {
+	var update Source
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	source, err := p.sources.Update(c.Param("id"), &update)
+	if err != nil {
+		c.JSON(sourceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Source updated successfully",
+		"source":  source,
+	})
+}
+
+// DeleteSourceHandler 删除订阅源，?remove_proxies=true 同时删除它添加的代理
+func (p *ProxyPool) DeleteSourceHandler(c *gin.Context) {
+	id := c.Param("id")
+	if err := p.sources.Delete(id); err != nil {
+		c.JSON(sourceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	removed := 0
+	if c.Query("remove_proxies") == "true" {
+		var err error
+		if removed, err = p.removeSourceProxies(id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Source deleted successfully",
+		"removed": removed,
+	})
+}
+
+// RefreshSourceHandler 立即拉取订阅源并返回结果
+func (p *ProxyPool) RefreshSourceHandler(c *gin.Context) {
+	source, err := p.RefreshSource(c.Param("id"))
+	if err != nil && source == nil {
+		c.JSON(sourceErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":  err.Error(),
+			"source": source,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Source refreshed",
+		"source":  source,
+	})
+}
+
+func sourceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errSourceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidSource):
+		return http.StatusBadRequest
+	case errors.Is(err, errSourceRefreshing):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
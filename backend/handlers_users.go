@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (p *ProxyPool) GetUsersHandler(c *gin.Context) {
+	users := p.users.List()
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"total": len(users),
+	})
+}
+
+func (p *ProxyPool) CreateUserHandler(c *gin.Context) {
+	var user User
+	if err := c.ShouldBindJSON(&user); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := p.users.Create(&user); err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User created successfully",
+		"user":    user,
+	})
+}
+
+func (p *ProxyPool) UpdateUserHandler(c *gin.Context) {
+	var update User
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := p.users.Update(c.Param("id"), &update)
+	if err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User updated successfully",
+		"user":    user,
+	})
+}
+
+func (p *ProxyPool) DeleteUserHandler(c *gin.Context) {
+	if err := p.users.Delete(c.Param("id")); err != nil {
+		c.JSON(userErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+func (p *ProxyPool) GetUserUsageHandler(c *gin.Context) {
+	user, ok := p.users.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": errUserNotFound.Error()})
+		return
+	}
+
+	usage := p.users.Usage(user.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"usage": usage,
+		"quota": gin.H{
+			"daily_byte_quota":      user.DailyByteQuota,
+			"monthly_byte_quota":    user.MonthlyByteQuota,
+			"daily_request_quota":   user.DailyRequestQuota,
+			"monthly_request_quota": user.MonthlyRequestQuota,
+			"bandwidth_limit":       user.BandwidthLimit,
+		},
+		"exceeded": usage.quotaError(user) != nil,
+	})
+}
+
+// userErrorStatus 将账号操作错误映射为 HTTP 状态码
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errUserExists):
+		return http.StatusConflict
+	case errors.Is(err, errInvalidUser):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// HealthCheckTarget 健康检查目标及其响应断言
+type HealthCheckTarget struct {
+	URL            string            `json:"url"`
+	Method         string            `json:"method"`
+	Headers        map[string]string `json:"headers"`
+	ExpectedStatus []int             `json:"expected_status"`
+	BodyContains   string            `json:"body_contains"`
+	BodyRegex      string            `json:"body_regex"`
+	MaxLatency     int               `json:"max_latency"`
+}
+
+var (
+	errBadStatus     = errors.New("unexpected status")
+	errBodyAssertion = errors.New("body assertion failed")
+	errTooSlow       = errors.New("latency above limit")
+)
+
+// maxCheckBody 断言时最多读取的响应体大小
+const maxCheckBody = 1 << 20
+
+func (t *HealthCheckTarget) validate() error {
+	if !strings.HasPrefix(t.URL, "http://") && !strings.HasPrefix(t.URL, "https://") {
+		return fmt.Errorf("invalid health check url %q", t.URL)
+	}
+	switch strings.ToUpper(t.Method) {
+	case "", http.MethodGet, http.MethodHead, http.MethodPost, http.MethodOptions:
+	default:
+		return fmt.Errorf("unsupported health check method %q", t.Method)
+	}
+	if t.BodyRegex != "" {
+		if _, err := regexp.Compile(t.BodyRegex); err != nil {
+			return fmt.Errorf("invalid body_regex: %w", err)
+		}
+	}
+	if t.MaxLatency < 0 {
+		return errors.New("max_latency must not be negative")
+	}
+	return nil
+}
+
+// validateHealthChecks 检查健康检查目标列表和法定通过数
+func validateHealthChecks(targets []HealthCheckTarget, quorum int) error {
+	for i := range targets {
+		if err := targets[i].validate(); err != nil {
+			return err
+		}
+	}
+	if quorum < 0 || (len(targets) > 0 && quorum > len(targets)) {
+		return fmt.Errorf("health_check_quorum must be between 0 and %d", len(targets))
+	}
+	return nil
+}
+
+// healthCheckTargets 返回生效的检查目标，未配置时退回 HealthCheckURL
+func (c *Config) healthCheckTargets() ([]HealthCheckTarget, int) {
+	if len(c.HealthChecks) == 0 {
+		return []HealthCheckTarget{{URL: c.HealthCheckURL}}, 1
+	}
+
+	quorum := c.HealthCheckQuorum
+	if quorum <= 0 {
+		quorum = len(c.HealthChecks)
+	}
+	return c.HealthChecks, quorum
+}
+
+// run 通过代理请求目标并校验状态码、响应体和延迟，返回耗时 (毫秒)
+func (t *HealthCheckTarget) run(ctx context.Context, client *http.Client) (int64, error) {
+	method := strings.ToUpper(t.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, t.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	for key, value := range t.Headers {
+		req.Header.Set(key, value)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return time.Since(start).Milliseconds(), err
+	}
+	defer resp.Body.Close()
+
+	var body []byte
+	if t.BodyContains != "" || t.BodyRegex != "" {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxCheckBody))
+		if err != nil {
+			return time.Since(start).Milliseconds(), err
+		}
+	}
+	latency := time.Since(start).Milliseconds()
+
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		return latency, fmt.Errorf("%w by proxy for %s", errProxyAuth, t.URL)
+	}
+	if len(t.ExpectedStatus) > 0 {
+		if !containsInt(t.ExpectedStatus, resp.StatusCode) {
+			return latency, fmt.Errorf("%w %d from %s, expected %v", errBadStatus, resp.StatusCode, t.URL, t.ExpectedStatus)
+		}
+	} else if resp.StatusCode >= 400 {
+		return latency, fmt.Errorf("%w %d from %s", errBadStatus, resp.StatusCode, t.URL)
+	}
+
+	if t.BodyContains != "" && !strings.Contains(string(body), t.BodyContains) {
+		return latency, fmt.Errorf("%w: %s does not contain %q", errBodyAssertion, t.URL, t.BodyContains)
+	}
+	if t.BodyRegex != "" {
+		re, err := regexp.Compile(t.BodyRegex)
+		if err != nil {
+			return latency, err
+		}
+		if !re.Match(body) {
+			return latency, fmt.Errorf("%w: %s does not match %q", errBodyAssertion, t.URL, t.BodyRegex)
+		}
+	}
+
+	if t.MaxLatency > 0 && latency > int64(t.MaxLatency) {
+		return latency, fmt.Errorf("%w: %s took %dms, limit %dms", errTooSlow, t.URL, latency, t.MaxLatency)
+	}
+
+	return latency, nil
+}
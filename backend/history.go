@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// CheckRecord 一次代理检查的历史记录
+type CheckRecord struct {
+	CheckedAt  time.Time  `json:"checked_at"`
+	Success    bool       `json:"success"`
+	Latency    int64      `json:"latency"`
+	ErrorClass ErrorClass `json:"error_class,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	ExitIP     string     `json:"exit_ip,omitempty"`
+}
+
+// HistorySummary 时间窗口内的检查统计，延迟分位数只统计成功的检查
+type HistorySummary struct {
+	Checks     int     `json:"checks"`
+	Successes  int     `json:"successes"`
+	Uptime     float64 `json:"uptime"`
+	LatencyP50 int64   `json:"latency_p50"`
+	LatencyP90 int64   `json:"latency_p90"`
+	LatencyP95 int64   `json:"latency_p95"`
+	LatencyP99 int64   `json:"latency_p99"`
+}
+
+// recordCheck 将检查结果写入历史表
+func (p *ProxyPool) recordCheck(proxy *Proxy, result checkResult) {
+	if p.db == nil {
+		return
+	}
+
+	record := &CheckRecord{
+		CheckedAt: time.Now().UTC(),
+		Success:   result.Success,
+		Latency:   result.Latency,
+		ExitIP:    result.ExitIP,
+	}
+	if !result.Success && result.Err != nil {
+		record.ErrorClass = classifyError(result.Err)
+		record.Error = result.Err.Error()
+	}
+
+	if err := p.db.SaveCheck(proxy.ID, record); err != nil {
+		log.Printf("Failed to save check history for proxy %s: %v", proxy.ID, err)
+	}
+}
+
+// summarizeChecks 计算在线率和延迟分位数
+func summarizeChecks(records []CheckRecord) HistorySummary {
+	summary := HistorySummary{Checks: len(records)}
+	var latencies []int64
+	for _, record := range records {
+		if record.Success {
+			summary.Successes++
+			latencies = append(latencies, record.Latency)
+		}
+	}
+	if summary.Checks > 0 {
+		summary.Uptime = float64(summary.Successes) * 100 / float64(summary.Checks)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	summary.LatencyP50 = percentile(latencies, 50)
+	summary.LatencyP90 = percentile(latencies, 90)
+	summary.LatencyP95 = percentile(latencies, 95)
+	summary.LatencyP99 = percentile(latencies, 99)
+	return summary
+}
+
+// percentile 按最近秩法取已排序数据的分位数
+func percentile(sorted []int64, q int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := (q*len(sorted)+99)/100 - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+// PruneHistory 删除超过保留天数的检查记录和域名统计，保留天数为 0 时不清理
+func (p *ProxyPool) PruneHistory() error {
+	p.mu.RLock()
+	days := p.config.HistoryRetentionDays
+	p.mu.RUnlock()
+
+	if p.db == nil || days <= 0 {
+		return nil
+	}
+
+	before := time.Now().UTC().AddDate(0, 0, -days)
+	removed, err := p.db.PruneChecks(before)
+	if err != nil {
+		return fmt.Errorf("prune check history: %w", err)
+	}
+	if removed > 0 {
+		log.Printf("Pruned %d check history records", removed)
+	}
+
+	// 长期没有访问的域名统计一并清理
+	p.domains.prune(before)
+	removed, err = p.db.PruneDomainStats(before)
+	if err != nil {
+		return fmt.Errorf("prune domain stats: %w", err)
+	}
+	if removed > 0 {
+		log.Printf("Pruned %d domain stats", removed)
+	}
+	return nil
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxJobHistory 每个任务保留的执行记录数
+const maxJobHistory = 50
+
+var (
+	errJobNotFound = errors.New("job not found")
+	errJobRunning  = errors.New("job is already running")
+)
+
+// JobSetting 任务的调度设置，保存在配置中，schedule 为空时使用默认值
+type JobSetting struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	Paused   bool   `json:"paused"`
+}
+
+// JobRun 一次任务执行记录，duration 为毫秒
+type JobRun struct {
+	StartedAt time.Time `json:"started_at"`
+	Duration  float64   `json:"duration"`
+	Trigger   string    `json:"trigger"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// JobStatus 任务的当前状态
+type JobStatus struct {
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	Schedule        string    `json:"schedule"`
+	DefaultSchedule string    `json:"default_schedule"`
+	Paused          bool      `json:"paused"`
+	Running         bool      `json:"running"`
+	NextRun         time.Time `json:"next_run"`
+	LastRun         time.Time `json:"last_run"`
+	LastDuration    float64   `json:"last_duration"`
+	AvgDuration     float64   `json:"avg_duration"`
+	LastError       string    `json:"last_error,omitempty"`
+	Runs            int64     `json:"runs"`
+	Failures        int64     `json:"failures"`
+}
+
+type job struct {
+	name            string
+	description     string
+	defaultSchedule string
+	run             func() error
+
+	spec     string
+	schedule schedule
+	paused   bool
+	running  bool
+	nextRun  time.Time
+	runs     int64
+	failures int64
+	history  []JobRun
+}
+
+// JobScheduler 按间隔或 cron 表达式运行后台任务，同一任务不会重叠执行
+type JobScheduler struct {
+	mu     sync.Mutex
+	jobs   map[string]*job
+	order  []string
+	wake   chan struct{}
+	active sync.WaitGroup
+}
+
+func NewJobScheduler() *JobScheduler {
+	return &JobScheduler{
+		jobs: make(map[string]*job),
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// Register 注册任务，默认调度表达式必须合法
+func (s *JobScheduler) Register(name, description, spec string, run func() error) {
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		panic(fmt.Sprintf("job %s: %v", name, err))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[name] = &job{
+		name:            name,
+		description:     description,
+		defaultSchedule: spec,
+		run:             run,
+		spec:            spec,
+		schedule:        sched,
+		nextRun:         sched.next(time.Now()),
+	}
+	s.order = append(s.order, name)
+}
+
+// Validate 检查任务设置，任务名必须已注册
+func (s *JobScheduler) Validate(settings []JobSetting) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, setting := range settings {
+		if _, ok := s.jobs[setting.Name]; !ok {
+			return fmt.Errorf("unknown job %q", setting.Name)
+		}
+		if seen[setting.Name] {
+			return fmt.Errorf("duplicate job setting %q", setting.Name)
+		}
+		seen[setting.Name] = true
+		if setting.Schedule == "" {
+			continue
+		}
+		if _, err := parseSchedule(setting.Schedule); err != nil {
+			return fmt.Errorf("job %s: %w", setting.Name, err)
+		}
+	}
+	return nil
+}
+
+// Apply 按设置更新任务的调度和暂停状态，未列出的任务恢复默认
+func (s *JobScheduler) Apply(settings []JobSetting) {
+	byName := make(map[string]JobSetting)
+	for _, setting := range settings {
+		byName[setting.Name] = setting
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	for _, j := range s.jobs {
+		setting := byName[j.name]
+		spec := setting.Schedule
+		if spec == "" {
+			spec = j.defaultSchedule
+		}
+		sched, err := parseSchedule(spec)
+		if err != nil {
+			log.Printf("Job %s: %v, using default schedule", j.name, err)
+			spec = j.defaultSchedule
+			sched, _ = parseSchedule(spec)
+		}
+
+		changed := spec != j.spec || setting.Paused != j.paused
+		j.spec = spec
+		j.schedule = sched
+		j.paused = setting.Paused
+		if changed {
+			j.nextRun = time.Time{}
+			if !j.paused {
+				j.nextRun = sched.next(now)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	s.notify()
+}
+
+func (s *JobScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run 运行调度循环直到 ctx 结束
+func (s *JobScheduler) Run(ctx context.Context) {
+	log.Println("Job scheduler started")
+
+	for {
+		timer := time.NewTimer(s.untilNext(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Println("Job scheduler stopped")
+			return
+		case <-s.wake:
+			timer.Stop()
+		case now := <-timer.C:
+			s.runDue(now)
+		}
+	}
+}
+
+// untilNext 距离最近一个待执行任务的时间
+func (s *JobScheduler) untilNext(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := time.Minute
+	for _, j := range s.jobs {
+		if j.paused || j.nextRun.IsZero() {
+			continue
+		}
+		if d := j.nextRun.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// runDue 启动所有到期的任务，上一次仍在执行的任务跳过本次
+func (s *JobScheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		if j.paused || j.nextRun.IsZero() || j.nextRun.After(now) {
+			continue
+		}
+		j.nextRun = j.schedule.next(now)
+		if !j.running {
+			s.start(j, "schedule")
+		}
+	}
+}
+
+// start 在新的 goroutine 中执行任务，调用方需持有锁
+func (s *JobScheduler) start(j *job, trigger string) {
+	j.running = true
+	s.active.Add(1)
+
+	go func() {
+		defer s.active.Done()
+
+		started := time.Now()
+		err := safeRun(j.run)
+		run := JobRun{
+			StartedAt: started,
+			Duration:  millis(time.Since(started)),
+			Trigger:   trigger,
+		}
+		if err != nil {
+			run.Error = err.Error()
+			log.Printf("Job %s failed: %v", j.name, err)
+		}
+
+		s.mu.Lock()
+		j.running = false
+		j.runs++
+		if err != nil {
+			j.failures++
+		}
+		j.history = append(j.history, run)
+		if len(j.history) > maxJobHistory {
+			j.history = j.history[len(j.history)-maxJobHistory:]
+		}
+		s.mu.Unlock()
+	}()
+}
+
+// Wait 等待正在执行的任务结束，超过 ctx 期限时返回 ctx 的错误
+func (s *JobScheduler) Wait(ctx context.Context) error {
+	if !s.busy() {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// busy 判断是否有任务正在执行
+func (s *JobScheduler) busy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, j := range s.jobs {
+		if j.running {
+			return true
+		}
+	}
+	return false
+}
+
+// safeRun 执行任务并将 panic 转为错误，避免单个任务拖垮进程
+func safeRun(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run()
+}
+
+// Trigger 立即执行任务，暂停的任务也可以手动执行
+func (s *JobScheduler) Trigger(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[name]
+	if !ok {
+		return errJobNotFound
+	}
+	if j.running {
+		return errJobRunning
+	}
+	s.start(j, "manual")
+	return nil
+}
+
+func (j *job) status() JobStatus {
+	status := JobStatus{
+		Name:            j.name,
+		Description:     j.description,
+		Schedule:        j.spec,
+		DefaultSchedule: j.defaultSchedule,
+		Paused:          j.paused,
+		Running:         j.running,
+		NextRun:         j.nextRun,
+		Runs:            j.runs,
+		Failures:        j.failures,
+	}
+	if len(j.history) > 0 {
+		last := j.history[len(j.history)-1]
+		status.LastRun = last.StartedAt
+		status.LastDuration = last.Duration
+		status.LastError = last.Error
+
+		var total float64
+		for _, run := range j.history {
+			total += run.Duration
+		}
+		status.AvgDuration = total / float64(len(j.history))
+	}
+	return status
+}
+
+// List 按注册顺序返回全部任务状态
+func (s *JobScheduler) List() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.order))
+	for _, name := range s.order {
+		statuses = append(statuses, s.jobs[name].status())
+	}
+	return statuses
+}
+
+// Get 返回任务状态和最近的执行记录 (从新到旧)
+func (s *JobScheduler) Get(name string) (JobStatus, []JobRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[name]
+	if !ok {
+		return JobStatus{}, nil, false
+	}
+	history := make([]JobRun, len(j.history))
+	for i, run := range j.history {
+		history[len(j.history)-1-i] = run
+	}
+	return j.status(), history, true
+}
+
+// RunJobs 运行后台任务调度直到 ctx 结束
+func (p *ProxyPool) RunJobs(ctx context.Context) {
+	p.jobs.Run(ctx)
+}
+
+// setJobPaused 暂停或恢复任务并保存到配置
+func (p *ProxyPool) setJobPaused(name string, paused bool) error {
+	if _, _, ok := p.jobs.Get(name); !ok {
+		return errJobNotFound
+	}
+
+	p.mu.Lock()
+	found := false
+	for i := range p.config.Jobs {
+		if p.config.Jobs[i].Name == name {
+			p.config.Jobs[i].Paused = paused
+			found = true
+		}
+	}
+	if !found {
+		p.config.Jobs = append(p.config.Jobs, JobSetting{Name: name, Paused: paused})
+	}
+	config := p.config
+	p.mu.Unlock()
+
+	p.jobs.Apply(config.Jobs)
+
+	if p.db != nil {
+		return p.db.SaveConfig(&config)
+	}
+	return nil
+}
+
+// GetJobsHandler 列出后台任务
+func (p *ProxyPool) GetJobsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"jobs": p.jobs.List()})
+}
+
+// GetJobHandler 返回任务状态和执行记录，?limit= 限制记录条数
+func (p *ProxyPool) GetJobHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(maxJobHistory)))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+		return
+	}
+
+	status, history, ok := p.jobs.Get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": errJobNotFound.Error()})
+		return
+	}
+	if len(history) > limit {
+		history = history[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job":     status,
+		"history": history,
+	})
+}
+
+// RunJobHandler 立即执行任务
+func (p *ProxyPool) RunJobHandler(c *gin.Context) {
+	switch err := p.jobs.Trigger(c.Param("name")); {
+	case errors.Is(err, errJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, errJobRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusAccepted, gin.H{"message": "Job started"})
+	}
+}
+
+// PauseJobHandler 暂停任务的定时执行
+func (p *ProxyPool) PauseJobHandler(c *gin.Context) {
+	p.handleJobPause(c, true)
+}
+
+// ResumeJobHandler 恢复任务的定时执行
+func (p *ProxyPool) ResumeJobHandler(c *gin.Context) {
+	p.handleJobPause(c, false)
+}
+
+func (p *ProxyPool) handleJobPause(c *gin.Context, paused bool) {
+	name := c.Param("name")
+	if err := p.setJobPaused(name, paused); err != nil {
+		if errors.Is(err, errJobNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save config"})
+		return
+	}
+
+	status, _, _ := p.jobs.Get(name)
+	c.JSON(http.StatusOK, status)
+}
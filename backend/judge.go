@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnonymityLevel string
+
+const (
+	AnonymityUnknown     AnonymityLevel = ""
+	AnonymityTransparent AnonymityLevel = "transparent"
+	AnonymityAnonymous   AnonymityLevel = "anonymous"
+	AnonymityElite       AnonymityLevel = "elite"
+)
+
+// rank 匿名等级排序，未知为 0
+func (a AnonymityLevel) rank() int {
+	switch a {
+	case AnonymityTransparent:
+		return 1
+	case AnonymityAnonymous:
+		return 2
+	case AnonymityElite:
+		return 3
+	}
+	return 0
+}
+
+func (a AnonymityLevel) valid() bool {
+	return a == AnonymityUnknown || a.rank() > 0
+}
+
+// proxyHeaders 代理常见的暴露自身存在的请求头
+var proxyHeaders = []string{
+	"Via",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+	"Forwarded",
+	"Forwarded-For",
+	"X-Real-Ip",
+	"X-Client-Ip",
+	"Client-Ip",
+	"X-Proxy-Id",
+	"Proxy-Connection",
+	"X-Bluecoat-Via",
+}
+
+// judgeResponse 判定端点返回的请求信息
+type judgeResponse struct {
+	IP      string              `json:"ip"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// judgeState 缓存本机直连时的出口 IP
+type judgeState struct {
+	mu        sync.Mutex
+	realIP    string
+	checkedAt time.Time
+}
+
+// JudgeHandler 回显请求来源 IP 和请求头，供代理匿名度检测使用
+func (p *ProxyPool) JudgeHandler(c *gin.Context) {
+	// 不使用 c.ClientIP()，否则会信任 X-Forwarded-For
+	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		ip = c.Request.RemoteAddr
+	}
+
+	c.JSON(http.StatusOK, judgeResponse{
+		IP:      ip,
+		Headers: c.Request.Header,
+	})
+}
+
+// fetchJudge 通过指定客户端请求判定端点
+func fetchJudge(client *http.Client, judgeURL string) (*judgeResponse, error) {
+	resp, err := client.Get(judgeURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("judge returned status %d", resp.StatusCode)
+	}
+
+	var result judgeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid judge response: %w", err)
+	}
+	return &result, nil
+}
+
+// realIP 不经代理访问公网 IP 回显地址得到本机出口 IP，结果缓存 10 分钟。
+// 判定端点是本服务自身，直连时只能看到回环或内网地址，不能用来获取公网 IP
+func (p *ProxyPool) realIP(echoURL string, timeout time.Duration) (string, error) {
+	p.judge.mu.Lock()
+	defer p.judge.mu.Unlock()
+
+	if p.judge.realIP != "" && time.Since(p.judge.checkedAt) < 10*time.Minute {
+		return p.judge.realIP, nil
+	}
+
+	ip, err := detectExitIP(&http.Client{Timeout: timeout}, echoURL)
+	if err != nil {
+		return "", err
+	}
+
+	p.judge.realIP = ip
+	p.judge.checkedAt = time.Now()
+	return ip, nil
+}
+
+// headerIPs 从请求头的值中提取 IP，支持 X-Forwarded-For 的逗号列表和 Forwarded 的 for= 参数
+func headerIPs(value string) []net.IP {
+	var ips []net.IP
+	fields := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t'
+	})
+	for _, field := range fields {
+		if len(field) > 4 && strings.EqualFold(field[:4], "for=") {
+			field = field[4:]
+		}
+		field = strings.Trim(field, `"`)
+		if host, _, err := net.SplitHostPort(field); err == nil {
+			field = host
+		}
+		field = strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
+		if ip := net.ParseIP(field); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips
+}
+
+// classifyAnonymity 根据判定结果区分透明、匿名和高匿代理
+func classifyAnonymity(result *judgeResponse, realIP string) AnonymityLevel {
+	if real := net.ParseIP(realIP); real != nil {
+		if ip := net.ParseIP(result.IP); ip != nil && ip.Equal(real) {
+			return AnonymityTransparent
+		}
+		for _, values := range result.Headers {
+			for _, value := range values {
+				for _, ip := range headerIPs(value) {
+					if ip.Equal(real) {
+						return AnonymityTransparent
+					}
+				}
+			}
+		}
+	}
+
+	for _, name := range proxyHeaders {
+		if len(http.Header(result.Headers).Values(name)) > 0 {
+			return AnonymityAnonymous
+		}
+	}
+
+	return AnonymityElite
+}
+
+// detectAnonymity 通过代理访问判定端点检测匿名度，未配置判定地址时返回未知
+func (p *ProxyPool) detectAnonymity(client *http.Client) (AnonymityLevel, *judgeResponse, error) {
+	p.mu.RLock()
+	judgeURL := p.config.JudgeURL
+	echoURL := p.config.IPEchoURL
+	timeout := time.Duration(p.config.Timeout) * time.Second
+	p.mu.RUnlock()
+
+	if judgeURL == "" {
+		return AnonymityUnknown, nil, nil
+	}
+
+	result, err := fetchJudge(client, judgeURL)
+	if err != nil {
+		return AnonymityUnknown, nil, err
+	}
+
+	// 不知道本机公网 IP 时无法识别透明代理，只记录出口 IP
+	if echoURL == "" {
+		return AnonymityUnknown, result, errors.New("ip_echo_url is required to detect the real IP")
+	}
+	realIP, err := p.realIP(echoURL, timeout)
+	if err != nil {
+		return AnonymityUnknown, result, fmt.Errorf("failed to detect real IP: %w", err)
+	}
+
+	return classifyAnonymity(result, realIP), result, nil
+}
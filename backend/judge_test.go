@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestClassifyAnonymity(t *testing.T) {
+	const realIP = "1.2.3.4"
+	tests := []struct {
+		name    string
+		ip      string
+		headers map[string][]string
+		want    AnonymityLevel
+	}{
+		{"real ip as source", "1.2.3.4", nil, AnonymityTransparent},
+		{"elite", "5.6.7.8", map[string][]string{"Accept": {"*/*"}}, AnonymityElite},
+		{"via header", "5.6.7.8", map[string][]string{"Via": {"1.1 squid"}}, AnonymityAnonymous},
+		{"forwarded for list", "5.6.7.8", map[string][]string{"X-Forwarded-For": {"10.0.0.1, 1.2.3.4"}}, AnonymityTransparent},
+		{"forwarded param", "5.6.7.8", map[string][]string{"Forwarded": {`for="1.2.3.4:51234";proto=http`}}, AnonymityTransparent},
+		{"real ip in unknown header", "5.6.7.8", map[string][]string{"X-Origin": {"1.2.3.4"}}, AnonymityTransparent},
+		{"similar ip", "5.6.7.8", map[string][]string{"X-Forwarded-For": {"11.2.3.45"}}, AnonymityAnonymous},
+		{"ip inside other text", "5.6.7.8", map[string][]string{"User-Agent": {"agent/1.2.3.4"}}, AnonymityElite},
+	}
+	for _, tt := range tests {
+		result := &judgeResponse{IP: tt.ip, Headers: tt.headers}
+		if got := classifyAnonymity(result, realIP); got != tt.want {
+			t.Errorf("%s: classifyAnonymity = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHeaderIPs(t *testing.T) {
+	ips := headerIPs(`for=192.0.2.60;proto=http;by=203.0.113.43, for="[2001:db8:cafe::17]:4711"`)
+	if len(ips) != 2 || ips[0].String() != "192.0.2.60" || ips[1].String() != "2001:db8:cafe::17" {
+		t.Errorf("headerIPs = %v", ips)
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -14,7 +19,6 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer db.Close()
 
 	// Initialize proxy pool with database
 	pool := NewProxyPoolWithDB(db)
@@ -24,8 +28,16 @@ func main() {
 		log.Printf("Failed to load from database: %v", err)
 	}
 
-	go pool.StartHealthCheck()
-	go pool.StartAutoRefresh()
+	// SIGINT / SIGTERM 触发有序关闭
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pool.StartValidationWorkers()
+	jobsDone := make(chan struct{})
+	go func() {
+		pool.RunJobs(ctx)
+		close(jobsDone)
+	}()
 
 	// Initialize proxy servers
 	proxyServer := NewProxyServer(pool)
@@ -50,14 +62,45 @@ func main() {
 		// Proxy management
 		api.GET("/proxies", pool.GetProxiesHandler)
 		api.POST("/proxies", pool.AddProxyHandler)
+		api.PUT("/proxies/:id", pool.UpdateProxyHandler)
 		api.DELETE("/proxies/:id", pool.DeleteProxyHandler)
+		api.POST("/proxies/:id/reset-usage", pool.ResetProxyUsageHandler)
+		api.GET("/proxies/:id/history", pool.GetProxyHistoryHandler)
+		api.GET("/domains", pool.GetDomainsHandler)
+		api.GET("/domains/:domain", pool.GetDomainHandler)
+		api.GET("/bans", pool.GetBansHandler)
+		api.DELETE("/bans", pool.ClearBansHandler)
 		api.POST("/proxies/import", pool.ImportProxiesHandler)
+		api.GET("/proxies/export", pool.ExportProxiesHandler)
 		api.POST("/proxies/validate", pool.ValidateProxiesHandler)
+		api.POST("/proxies/test", pool.TestProxyURLHandler)
+		api.POST("/proxies/:id/test", pool.TestProxyHandler)
+
+		// Ingress users
+		api.GET("/users", pool.GetUsersHandler)
+		api.POST("/users", pool.CreateUserHandler)
+		api.PUT("/users/:id", pool.UpdateUserHandler)
+		api.DELETE("/users/:id", pool.DeleteUserHandler)
+		api.GET("/users/:id/usage", pool.GetUserUsageHandler)
 
 		// Configuration
 		api.GET("/config", pool.GetConfigHandler)
 		api.PUT("/config", pool.UpdateConfigHandler)
 
+		// Proxy sources
+		api.GET("/sources", pool.GetSourcesHandler)
+		api.POST("/sources", pool.CreateSourceHandler)
+		api.PUT("/sources/:id", pool.UpdateSourceHandler)
+		api.DELETE("/sources/:id", pool.DeleteSourceHandler)
+		api.POST("/sources/:id/refresh", pool.RefreshSourceHandler)
+
+		// Background jobs
+		api.GET("/jobs", pool.GetJobsHandler)
+		api.GET("/jobs/:name", pool.GetJobHandler)
+		api.POST("/jobs/:name/run", pool.RunJobHandler)
+		api.POST("/jobs/:name/pause", pool.PauseJobHandler)
+		api.POST("/jobs/:name/resume", pool.ResumeJobHandler)
+
 		// Statistics
 		api.GET("/stats", pool.GetStatsHandler)
 		api.GET("/stats/realtime", pool.GetRealtimeStatsHandler)
@@ -66,6 +109,12 @@ func main() {
 		api.GET("/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{"status": "ok"})
 		})
+
+		// Anonymity judge, reached by upstream proxies during validation
+		api.GET("/judge", pool.JudgeHandler)
+
+		// Throughput test payload, downloaded through upstream proxies during validation
+		api.GET("/speedtest", pool.SpeedTestHandler)
 	}
 
 	// Serve static files as fallback
@@ -80,8 +129,43 @@ func main() {
 		port = "3000"
 	}
 
-	log.Printf("Server starting on port %s", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatal(err)
+	// API 请求的 context 在收到信号时取消，实时统计等长连接随之结束
+	apiServer := &http.Server{
+		Addr:        ":" + port,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := apiServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	timeout := pool.ShutdownTimeout()
+	log.Printf("Shutting down, waiting up to %s for connections to finish", timeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 代理入口和 API 同时停止接受新连接，共用同一个期限等待已有连接结束
+	proxyDone := make(chan struct{})
+	go func() {
+		defer close(proxyDone)
+		proxyServer.Shutdown(shutdownCtx)
+	}()
+	if err := apiServer.Shutdown(shutdownCtx); err != nil {
+		apiServer.Close()
+	}
+	<-proxyDone
+	<-jobsDone
+	pool.Shutdown(shutdownCtx)
+
+	if err := db.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
 	}
+	log.Println("Shutdown complete")
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"sync"
 	"time"
 )
@@ -8,9 +9,11 @@ import (
 type ProxyType string
 
 const (
-	HTTP    ProxyType = "http"
-	HTTPS   ProxyType = "https"
-	SOCKS5  ProxyType = "socks5"
+	HTTP   ProxyType = "http"
+	HTTPS  ProxyType = "https"
+	SOCKS5 ProxyType = "socks5"
+	SOCKS4 ProxyType = "socks4"
+	Auto   ProxyType = "auto"
 )
 
 type ProxyStatus string
@@ -22,18 +25,41 @@ const (
 )
 
 type Proxy struct {
-	ID           string      `json:"id"`
-	Address      string      `json:"address"`
-	Port         int         `json:"port"`
-	Type         ProxyType   `json:"type"`
-	Username     string      `json:"username,omitempty"`
-	Password     string      `json:"password,omitempty"`
-	Status       ProxyStatus `json:"status"`
-	ResponseTime int64       `json:"response_time"`
-	SuccessCount int64       `json:"success_count"`
-	FailCount    int64       `json:"fail_count"`
-	LastCheck    time.Time   `json:"last_check"`
-	CreatedAt    time.Time   `json:"created_at"`
+	ID             string                   `json:"id"`
+	Address        string                   `json:"address"`
+	Port           int                      `json:"port"`
+	Type           ProxyType                `json:"type"`
+	Username       string                   `json:"username,omitempty"`
+	Password       string                   `json:"password,omitempty"`
+	Status         ProxyStatus              `json:"status"`
+	ResponseTime   int64                    `json:"response_time"`
+	SuccessCount   int64                    `json:"success_count"`
+	FailCount      int64                    `json:"fail_count"`
+	LastCheck      time.Time                `json:"last_check"`
+	CreatedAt      time.Time                `json:"created_at"`
+	Tags           []string                 `json:"tags"`
+	BytesUp        int64                    `json:"bytes_up"`
+	BytesDown      int64                    `json:"bytes_down"`
+	MonthlyBytes   int64                    `json:"monthly_bytes"`
+	UsageMonth     string                   `json:"usage_month"`
+	MonthlyDataCap int64                    `json:"monthly_data_cap"`
+	Anonymity      AnonymityLevel           `json:"anonymity"`
+	ExitIP         string                   `json:"exit_ip"`
+	Protocols      []ProxyType              `json:"protocols"`
+	TLS            bool                     `json:"tls"`
+	Capabilities   *ProxyCapabilities       `json:"capabilities,omitempty"`
+	LastErrorClass ErrorClass               `json:"last_error_class"`
+	LastError      string                   `json:"last_error"`
+	LastErrorAt    time.Time                `json:"last_error_at"`
+	NextCheck      time.Time                `json:"next_check"`
+	Throughput     int64                    `json:"throughput"`
+	Untrusted      bool                     `json:"untrusted"`
+	ProfileHealth  map[string]ProfileHealth `json:"profile_health,omitempty"`
+	SourceID       string                   `json:"source_id,omitempty"`
+	Country        string                   `json:"country"`
+
+	savedBytes    int64
+	successStreak int
 }
 
 type RotationMode string
@@ -42,71 +68,136 @@ const (
 	Sequential RotationMode = "sequential"
 	Random     RotationMode = "random"
 	LeastUsed  RotationMode = "least_used"
+	Throughput RotationMode = "throughput"
+	Learned    RotationMode = "learned"
 )
 
 type Config struct {
-	RotationMode     RotationMode `json:"rotation_mode"`
-	HealthCheckURL   string       `json:"health_check_url"`
-	CheckInterval    int          `json:"check_interval"`
-	Timeout          int          `json:"timeout"`
-	MaxFailCount     int          `json:"max_fail_count"`
-	EnableAuth       bool         `json:"enable_auth"`
-	AuthUsername     string       `json:"auth_username"`
-	AuthPassword     string       `json:"auth_password"`
-	AutoRefresh      bool         `json:"auto_refresh"`
-	RefreshInterval  int          `json:"refresh_interval"`
+	RotationMode           RotationMode         `json:"rotation_mode"`
+	HealthCheckURL         string               `json:"health_check_url"`
+	CheckInterval          int                  `json:"check_interval"`
+	Timeout                int                  `json:"timeout"`
+	MaxFailCount           int                  `json:"max_fail_count"`
+	EnableAuth             bool                 `json:"enable_auth"`
+	AuthUsername           string               `json:"auth_username"`
+	AuthPassword           string               `json:"auth_password"`
+	AutoRefresh            bool                 `json:"auto_refresh"`
+	RefreshInterval        int                  `json:"refresh_interval"`
+	DestinationACL         DestinationACL       `json:"destination_acl"`
+	HTTPClientACL          ClientACL            `json:"http_client_acl"`
+	SOCKS5ClientACL        ClientACL            `json:"socks5_client_acl"`
+	JudgeURL               string               `json:"judge_url"`
+	MinAnonymity           AnonymityLevel       `json:"min_anonymity"`
+	HealthChecks           []HealthCheckTarget  `json:"health_checks"`
+	HealthCheckQuorum      int                  `json:"health_check_quorum"`
+	ValidationWorkers      int                  `json:"validation_workers"`
+	IPEchoURL              string               `json:"ip_echo_url"`
+	CollapseDuplicateExits bool                 `json:"collapse_duplicate_exits"`
+	CapabilityPorts        []int                `json:"capability_ports"`
+	CapabilityHost         string               `json:"capability_host"`
+	HistoryRetentionDays   int                  `json:"history_retention_days"`
+	ThroughputURL          string               `json:"throughput_url"`
+	ThroughputBytes        int64                `json:"throughput_bytes"`
+	MinThroughput          int64                `json:"min_throughput"`
+	SkipTLSVerify          bool                 `json:"skip_tls_verify"`
+	TLSCheckHost           string               `json:"tls_check_host"`
+	HealthProfiles         []HealthCheckProfile `json:"health_profiles"`
+	BanRules               []BanRule            `json:"ban_rules"`
+	Jobs                   []JobSetting         `json:"jobs"`
+	BackupRetention        int                  `json:"backup_retention"`
+	ShutdownTimeout        int                  `json:"shutdown_timeout"`
 }
 
 type ProxyPool struct {
-	proxies      map[string]*Proxy
+	proxies       map[string]*Proxy
 	activeProxies []*Proxy
-	mu           sync.RWMutex
-	config       Config
-	currentIndex uint32
-	stats        Stats
-	db           *Database
+	mu            sync.RWMutex
+	config        Config
+	currentIndex  uint32
+	stats         Stats
+	db            *Database
+	users         *UserStore
+	sources       *SourceStore
+	judge         judgeState
+	fingerprints  fingerprintState
+	bans          banState
+	domains       domainStatsState
+	jobs          *JobScheduler
+	validation    *ValidationQueue
 }
 
 type Stats struct {
-	TotalProxies   int   `json:"total_proxies"`
-	ActiveProxies  int   `json:"active_proxies"`
-	TotalRequests  int64 `json:"total_requests"`
+	TotalProxies    int   `json:"total_proxies"`
+	ActiveProxies   int   `json:"active_proxies"`
+	TotalRequests   int64 `json:"total_requests"`
 	SuccessRequests int64 `json:"success_requests"`
-	FailedRequests int64 `json:"failed_requests"`
+	FailedRequests  int64 `json:"failed_requests"`
+	RejectedClients int64 `json:"rejected_clients"`
+	AuthFailures    int64 `json:"auth_failures"`
+	ValidationQueue int   `json:"validation_queue"`
 }
 
 func NewProxyPool() *ProxyPool {
-	return &ProxyPool{
+	p := &ProxyPool{
 		proxies: make(map[string]*Proxy),
+		users:   NewUserStore(nil),
+		sources: NewSourceStore(nil),
 		config: Config{
-			RotationMode:    Sequential,
-			HealthCheckURL:  "http://www.google.com",
-			CheckInterval:   60,
-			Timeout:         10,
-			MaxFailCount:    3,
-			EnableAuth:      false,
-			AutoRefresh:     true,
-			RefreshInterval: 300,
+			RotationMode:         Sequential,
+			HealthCheckURL:       "http://www.google.com",
+			CheckInterval:        60,
+			Timeout:              10,
+			MaxFailCount:         3,
+			EnableAuth:           false,
+			AutoRefresh:          true,
+			RefreshInterval:      300,
+			ValidationWorkers:    defaultValidationWorkers,
+			HistoryRetentionDays: 7,
+			BackupRetention:      defaultBackupRetention,
+			ShutdownTimeout:      defaultShutdownTimeout,
 		},
+		jobs: NewJobScheduler(),
 	}
+	p.validation = NewValidationQueue(p.validateProxy, p.checkProfile)
+	p.registerJobs()
+	return p
 }
 
 // NewProxyPoolWithDB 创建带数据库的代理池
 func NewProxyPoolWithDB(db *Database) *ProxyPool {
-	return &ProxyPool{
+	p := &ProxyPool{
 		proxies: make(map[string]*Proxy),
 		db:      db,
+		users:   NewUserStore(db),
+		sources: NewSourceStore(db),
 		config: Config{
-			RotationMode:    Sequential,
-			HealthCheckURL:  "http://www.google.com",
-			CheckInterval:   60,
-			Timeout:         10,
-			MaxFailCount:    3,
-			EnableAuth:      false,
-			AutoRefresh:     true,
-			RefreshInterval: 300,
+			RotationMode:         Sequential,
+			HealthCheckURL:       "http://www.google.com",
+			CheckInterval:        60,
+			Timeout:              10,
+			MaxFailCount:         3,
+			EnableAuth:           false,
+			AutoRefresh:          true,
+			RefreshInterval:      300,
+			ValidationWorkers:    defaultValidationWorkers,
+			HistoryRetentionDays: 7,
+			BackupRetention:      defaultBackupRetention,
+			ShutdownTimeout:      defaultShutdownTimeout,
 		},
+		jobs: NewJobScheduler(),
 	}
+	p.validation = NewValidationQueue(p.validateProxy, p.checkProfile)
+	p.registerJobs()
+	return p
+}
+
+// StartValidationWorkers 按配置启动验证 worker
+func (p *ProxyPool) StartValidationWorkers() {
+	p.mu.RLock()
+	workers := p.config.ValidationWorkers
+	p.mu.RUnlock()
+
+	p.validation.SetWorkers(workers)
 }
 
 // LoadFromDatabase 从数据库加载代理和配置
@@ -118,9 +209,23 @@ func (p *ProxyPool) LoadFromDatabase() error {
 	// 加载配置
 	config, err := p.db.LoadConfig()
 	if err == nil {
+		if err := validateBanRules(config.BanRules); err != nil {
+			log.Printf("Failed to compile ban rules: %v", err)
+		}
 		p.mu.Lock()
 		p.config = *config
 		p.mu.Unlock()
+		p.jobs.Apply(config.Jobs)
+	}
+
+	// 加载入口账号
+	if err := p.users.Load(); err != nil {
+		return err
+	}
+
+	// 加载订阅源
+	if err := p.sources.Load(); err != nil {
+		return err
 	}
 
 	// 加载代理
@@ -136,7 +241,8 @@ func (p *ProxyPool) LoadFromDatabase() error {
 			p.activeProxies = append(p.activeProxies, proxy)
 		}
 	}
+	p.spreadChecks()
 	p.mu.Unlock()
 
-	return nil
+	return p.LoadDomainStats()
 }
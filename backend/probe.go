@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// protocolPreference 自动识别时选择转发协议的优先级，https 表示 TLS 包裹的 HTTP 代理
+var protocolPreference = []ProxyType{SOCKS5, HTTP, HTTPS, SOCKS4}
+
+// detectProtocols 依次探测代理支持的协议，返回按优先级排列的列表
+func (p *ProxyPool) detectProtocols(proxy *Proxy) []ProxyType {
+	p.mu.RLock()
+	timeout := time.Duration(p.config.Timeout) * time.Second
+	targets, _ := p.config.healthCheckTargets()
+	p.mu.RUnlock()
+
+	target := probeTarget(targets)
+
+	// 各协议并发探测，结果按优先级排列
+	results := make([]error, len(protocolPreference))
+	var wg sync.WaitGroup
+	for i, protocol := range protocolPreference {
+		wg.Add(1)
+		go func(i int, protocol ProxyType) {
+			defer wg.Done()
+			switch protocol {
+			case SOCKS5:
+				results[i] = probeSOCKS5(proxy, timeout)
+			case HTTP:
+				results[i] = probeHTTPConnect(proxy, target, false, timeout)
+			case HTTPS:
+				results[i] = probeHTTPConnect(proxy, target, true, timeout)
+			case SOCKS4:
+				results[i] = probeSOCKS4(proxy, target, timeout)
+			}
+		}(i, protocol)
+	}
+	wg.Wait()
+
+	var protocols []ProxyType
+	for i, err := range results {
+		if err == nil {
+			protocols = append(protocols, protocolPreference[i])
+		}
+	}
+	return protocols
+}
+
+// applyProtocol 按探测结果选择最优协议用于转发
+func (proxy *Proxy) applyProtocol(protocols []ProxyType) {
+	proxy.Protocols = protocols
+	if len(protocols) == 0 {
+		return
+	}
+
+	switch protocols[0] {
+	case HTTPS:
+		proxy.Type = HTTP
+		proxy.TLS = true
+	default:
+		proxy.Type = protocols[0]
+		proxy.TLS = false
+	}
+}
+
+// probeTarget 从健康检查地址中取出探测用的 host:port
+func probeTarget(targets []HealthCheckTarget) string {
+	for _, target := range targets {
+		u, err := url.Parse(target.URL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		return net.JoinHostPort(u.Hostname(), port)
+	}
+	return "www.google.com:80"
+}
+
+// probeSOCKS5 发送 SOCKS5 握手，代理接受无认证或用户名密码认证即视为支持
+func probeSOCKS5(proxy *Proxy, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", proxy.addr(), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	return socks5Handshake(conn, proxy)
+}
+
+// socks5Handshake 完成 SOCKS5 方法协商和用户名密码认证
+func socks5Handshake(conn net.Conn, proxy *Proxy) error {
+	if _, err := conn.Write([]byte{0x05, 0x02, 0x00, 0x02}); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 0x05 {
+		return fmt.Errorf("not a SOCKS5 proxy")
+	}
+
+	switch reply[1] {
+	case 0x00:
+		return nil
+	case 0x02:
+		if proxy.Username == "" {
+			return fmt.Errorf("SOCKS5 proxy requires credentials")
+		}
+		auth := []byte{0x01, byte(len(proxy.Username))}
+		auth = append(auth, proxy.Username...)
+		auth = append(auth, byte(len(proxy.Password)))
+		auth = append(auth, proxy.Password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0x00 {
+			return fmt.Errorf("SOCKS5 authentication failed")
+		}
+		return nil
+	}
+	return fmt.Errorf("SOCKS5 proxy offered no acceptable method")
+}
+
+// probeSOCKS4 发送 SOCKS4a CONNECT，收到 SOCKS4 格式的应答即视为支持
+func probeSOCKS4(proxy *Proxy, target string, timeout time.Duration) error {
+	conn, err := dialSOCKS4(context.Background(), &Proxy{
+		Address:  proxy.Address,
+		Port:     proxy.Port,
+		Username: proxy.Username,
+	}, target, timeout)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+	return nil
+}
+
+// probeHTTPConnect 发送 CONNECT 请求，代理返回 2xx 即视为支持，useTLS 时先与代理建立 TLS
+func probeHTTPConnect(proxy *Proxy, target string, useTLS bool, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", proxy.addr(), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var rw net.Conn = conn
+	if useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         proxy.Address,
+			InsecureSkipVerify: true,
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		rw = tlsConn
+	}
+
+	req := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
+	if proxy.Username != "" && proxy.Password != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.Username + ":" + proxy.Password))
+		req += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	req += "\r\n"
+	if _, err := rw.Write([]byte(req)); err != nil {
+		return err
+	}
+
+	status, err := bufio.NewReader(rw).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "HTTP/") {
+		return fmt.Errorf("not an HTTP proxy")
+	}
+	if !strings.HasPrefix(fields[1], "2") {
+		return fmt.Errorf("CONNECT rejected: %s", strings.TrimSpace(status))
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// HealthCheckProfile 针对某组代理的健康检查方案，检查带有任一标签的代理，未设置标签时检查全部代理
+type HealthCheckProfile struct {
+	Name     string              `json:"name"`
+	Tags     []string            `json:"tags"`
+	Targets  []HealthCheckTarget `json:"targets"`
+	Quorum   int                 `json:"quorum"`
+	Interval int                 `json:"interval"`
+}
+
+// ProfileHealth 代理在某个检查方案下的健康状态
+type ProfileHealth struct {
+	Status       ProxyStatus `json:"status"`
+	ResponseTime int64       `json:"response_time"`
+	FailCount    int64       `json:"fail_count"`
+	LastCheck    time.Time   `json:"last_check"`
+	NextCheck    time.Time   `json:"next_check"`
+	LastError    string      `json:"last_error,omitempty"`
+}
+
+func (profile *HealthCheckProfile) validate() error {
+	if profile.Name == "" {
+		return errors.New("health profile name is required")
+	}
+	if len(profile.Targets) == 0 {
+		return fmt.Errorf("health profile %q has no targets", profile.Name)
+	}
+	if profile.Interval < 0 {
+		return fmt.Errorf("health profile %q interval must not be negative", profile.Name)
+	}
+	if err := validateHealthChecks(profile.Targets, profile.Quorum); err != nil {
+		return fmt.Errorf("health profile %q: %w", profile.Name, err)
+	}
+	return nil
+}
+
+// validateHealthProfiles 检查方案列表，名称不可重复
+func validateHealthProfiles(profiles []HealthCheckProfile) error {
+	seen := make(map[string]bool)
+	for i := range profiles {
+		if err := profiles[i].validate(); err != nil {
+			return err
+		}
+		if seen[profiles[i].Name] {
+			return fmt.Errorf("duplicate health profile %q", profiles[i].Name)
+		}
+		seen[profiles[i].Name] = true
+	}
+	return nil
+}
+
+// appliesTo 判断方案是否检查该代理
+func (profile *HealthCheckProfile) appliesTo(proxy *Proxy) bool {
+	return len(profile.Tags) == 0 || proxy.hasAnyTag(profile.Tags)
+}
+
+// quorum 生效的法定通过数，未设置时要求全部通过
+func (profile *HealthCheckProfile) quorum() int {
+	if profile.Quorum <= 0 {
+		return len(profile.Targets)
+	}
+	return profile.Quorum
+}
+
+// healthProfile 按名称查找检查方案
+func (c *Config) healthProfile(name string) (HealthCheckProfile, bool) {
+	for _, profile := range c.HealthProfiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return HealthCheckProfile{}, false
+}
+
+// healthyFor 判断代理对请求的标签组是否可用。
+// 未设置标签的方案对所有请求生效，设置了标签的方案只在与请求标签相交时参与判断，
+// 尚未检查的方案视为可用。调用方需持有读锁。
+func (p *ProxyPool) healthyFor(proxy *Proxy, tags []string) bool {
+	for i := range p.config.HealthProfiles {
+		profile := &p.config.HealthProfiles[i]
+		if len(profile.Tags) > 0 && !intersects(profile.Tags, tags) {
+			continue
+		}
+		if !profile.appliesTo(proxy) {
+			continue
+		}
+		if health, ok := proxy.ProfileHealth[profile.Name]; ok && health.Status == StatusInactive {
+			return false
+		}
+	}
+	return true
+}
+
+// intersects 判断两个字符串列表是否有相同元素
+func intersects(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkProfile 按检查方案检查代理并更新该方案下的健康状态
+func (p *ProxyPool) checkProfile(proxy *Proxy, name string) {
+	p.mu.RLock()
+	profile, ok := p.config.healthProfile(name)
+	p.mu.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	var client *http.Client
+	if proxy.Type == SOCKS5 {
+		client = p.createSOCKS5Client(proxy)
+	} else {
+		client = p.createHTTPClient(proxy)
+	}
+
+	result := runTargets(client, profile.Targets, profile.quorum())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := proxy.ProfileHealth[name]
+	health.LastCheck = time.Now()
+	health.ResponseTime = result.Latency
+	if result.Success {
+		health.Status = StatusActive
+		health.FailCount = 0
+		health.LastError = ""
+	} else {
+		health.FailCount++
+		if health.FailCount >= int64(p.config.MaxFailCount) {
+			health.Status = StatusInactive
+		}
+		health.LastError = result.Err.Error()
+		log.Printf("Proxy %s:%d failed health profile %q: %v", proxy.Address, proxy.Port, name, result.Err)
+	}
+
+	interval := time.Duration(profile.Interval) * time.Second
+	if interval <= 0 {
+		interval = time.Duration(p.config.CheckInterval) * time.Second
+	}
+	health.NextCheck = time.Now().Add(jitter(interval))
+
+	// 写时复制：代理快照与 SaveProxy 会在锁外读取旧的 map，这里不能原地修改
+	profiles := make(map[string]ProfileHealth, len(proxy.ProfileHealth)+1)
+	for existing, state := range proxy.ProfileHealth {
+		// 清理已删除方案的状态
+		if _, ok := p.config.healthProfile(existing); ok {
+			profiles[existing] = state
+		}
+	}
+	profiles[name] = health
+	proxy.ProfileHealth = profiles
+}
+
+// dueProfiles 返回代理到期需要检查的方案名称，调用方需持有读锁
+func (p *ProxyPool) dueProfiles(proxy *Proxy, now time.Time) []string {
+	var due []string
+	for i := range p.config.HealthProfiles {
+		profile := &p.config.HealthProfiles[i]
+		if !profile.appliesTo(proxy) {
+			continue
+		}
+		if health, ok := proxy.ProfileHealth[profile.Name]; ok && health.NextCheck.After(now) {
+			continue
+		}
+		due = append(due, profile.Name)
+	}
+	return due
+}
@@ -1,48 +1,82 @@
 package main
 
 import (
-	"encoding/base64"
-	"fmt"
-	"io"
+	"context"
 	"log"
 	"net"
 	"net/http"
-	"strings"
 	"sync/atomic"
 	"time"
-
-	socks "golang.org/x/net/proxy"
 )
 
-func (ps *ProxyServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
-	proxy := ps.pool.GetNextProxy()
+func (ps *ProxyServer) handleHTTP(w http.ResponseWriter, r *http.Request, user *User) {
+	defaultPort := 80
+	if r.URL.Scheme == "https" {
+		defaultPort = 443
+	}
+	host, port, err := splitTarget(r.URL.Host, defaultPort)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := ps.authorizeDestination(r.Context(), user, host, port); err != nil {
+		log.Printf("Blocked request to %s: %v", r.URL.Host, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// https 地址经上游 CONNECT 隧道转发
+	opts := user.selectOptions()
+	opts.Host = normalizeHost(host)
+	if r.URL.Scheme == "https" {
+		opts.NeedConnect = true
+		opts.Port = port
+	}
+	proxy := ps.pool.SelectProxy(opts)
 	if proxy == nil {
 		http.Error(w, "No available proxy", http.StatusServiceUnavailable)
 		atomic.AddInt64(&ps.pool.stats.FailedRequests, 1)
 		return
 	}
 
+	session, err := ps.beginSession(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
 	atomic.AddInt64(&ps.pool.stats.TotalRequests, 1)
+	session.proxy = proxy
 
-	proxyURL := ps.pool.buildProxyURL(proxy)
 	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-		},
+		Transport: ps.pool.newUpstreamTransport(proxy, 10*time.Second),
 	}
 
 	outReq := r.Clone(r.Context())
 	outReq.RequestURI = ""
+	// 入口凭证只用于本网关，不能转发给上游代理
+	outReq.Header.Del("Proxy-Authorization")
+	outReq.Header.Del("Proxy-Connection")
+	if outReq.Body != nil && outReq.Body != http.NoBody {
+		outReq.Body = &meteredBody{ReadCloser: outReq.Body, session: session}
+	}
 
+	start := time.Now()
 	resp, err := client.Do(outReq)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		atomic.AddInt64(&proxy.FailCount, 1)
 		atomic.AddInt64(&ps.pool.stats.FailedRequests, 1)
+		ps.pool.recordFailure(proxy, err)
+		ps.pool.recordOutcome(proxy, opts.Host, false, time.Since(start))
 		return
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusProxyAuthRequired {
+		ps.pool.recordFailure(proxy, errProxyAuth)
+	}
+
 	atomic.AddInt64(&proxy.SuccessCount, 1)
 	atomic.AddInt64(&ps.pool.stats.SuccessRequests, 1)
 
@@ -51,18 +85,43 @@ func (ps *ProxyServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
 			w.Header().Add(key, value)
 		}
 	}
+	inspection := ps.pool.inspectResponse(proxy, opts.Host, resp)
+	latency := time.Since(start)
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	session.copy(w, inspection, false)
+	banned := inspection.finish()
+	ps.pool.recordOutcome(proxy, opts.Host, !banned && !statusFailed(resp.StatusCode), latency)
 }
 
-func (ps *ProxyServer) handleHTTPSConnect(w http.ResponseWriter, r *http.Request) {
-	proxy := ps.pool.GetNextProxy()
+func (ps *ProxyServer) handleHTTPSConnect(w http.ResponseWriter, r *http.Request, user *User) {
+	host, port, err := splitTarget(r.Host, 443)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := ps.authorizeDestination(r.Context(), user, host, port); err != nil {
+		log.Printf("Blocked CONNECT to %s: %v", r.Host, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	opts := user.selectOptions()
+	opts.NeedConnect = true
+	opts.Port = port
+	opts.Host = normalizeHost(host)
+	proxy := ps.pool.SelectProxy(opts)
 	if proxy == nil {
 		http.Error(w, "No available proxy", http.StatusServiceUnavailable)
 		atomic.AddInt64(&ps.pool.stats.FailedRequests, 1)
 		return
 	}
 
+	session, err := ps.beginSession(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
 	atomic.AddInt64(&ps.pool.stats.TotalRequests, 1)
 
 	hijacker, ok := w.(http.Hijacker)
@@ -78,22 +137,26 @@ func (ps *ProxyServer) handleHTTPSConnect(w http.ResponseWriter, r *http.Request
 	}
 	defer clientConn.Close()
 
-	// 通过代理池的代理连接到目标
-	var targetConn net.Conn
-	if proxy.Type == SOCKS5 {
-		targetConn, err = ps.dialThroughSOCKS5(proxy, r.Host)
-	} else {
-		targetConn, err = ps.dialThroughHTTPProxy(proxy, r.Host)
+	// 隧道不受 http.Server.Shutdown 管理，单独登记以便关闭时等待
+	if !ps.conns.add(clientConn) {
+		return
 	}
+	defer ps.conns.done(clientConn)
+
+	// 通过代理池的代理连接到目标
+	start := time.Now()
+	targetConn, err := ps.dialThroughProxy(proxy, r.Host)
 
 	if err != nil {
-		log.Printf("Failed to connect through proxy %s:%d: %v", proxy.Address, proxy.Port, err)
 		atomic.AddInt64(&proxy.FailCount, 1)
+		ps.pool.recordFailure(proxy, err)
+		ps.pool.recordOutcome(proxy, opts.Host, false, time.Since(start))
 		atomic.AddInt64(&ps.pool.stats.FailedRequests, 1)
 		clientConn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
 		return
 	}
 	defer targetConn.Close()
+	connected := time.Since(start)
 
 	clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
 
@@ -101,75 +164,13 @@ func (ps *ProxyServer) handleHTTPSConnect(w http.ResponseWriter, r *http.Request
 	atomic.AddInt64(&ps.pool.stats.SuccessRequests, 1)
 
 	// 双向转发数据
-	go io.Copy(targetConn, clientConn)
-	io.Copy(clientConn, targetConn)
-}
-// dialThroughHTTPProxy 通过 HTTP/HTTPS 代理连接到目标
-func (ps *ProxyServer) dialThroughHTTPProxy(proxy *Proxy, target string) (net.Conn, error) {
-	// 连接到代理服务器
-	proxyAddr := fmt.Sprintf("%s:%d", proxy.Address, proxy.Port)
-	conn, err := net.DialTimeout("tcp", proxyAddr, 10*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
-	}
-
-	// 发送 CONNECT 请求
-	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
-	
-	// 如果需要认证
-	if proxy.Username != "" && proxy.Password != "" {
-		auth := proxy.Username + ":" + proxy.Password
-		basicAuth := base64.StdEncoding.EncodeToString([]byte(auth))
-		connectReq += fmt.Sprintf("Proxy-Authorization: Basic %s\r\n", basicAuth)
-	}
-	
-	connectReq += "\r\n"
-
-	// 发送请求
-	if _, err := conn.Write([]byte(connectReq)); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to send CONNECT: %w", err)
-	}
-
-	// 读取响应
-	buf := make([]byte, 4096)
-	n, err := conn.Read(buf)
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to read CONNECT response: %w", err)
-	}
-
-	response := string(buf[:n])
-	if !strings.Contains(response, "200") {
-		conn.Close()
-		return nil, fmt.Errorf("proxy returned non-200 response: %s", response)
-	}
-
-	return conn, nil
+	session.proxy = proxy
+	downstream, err := session.tunnel(clientConn, targetConn)
+	ps.pool.inspectTunnel(proxy, opts.Host, downstream, err)
+	ps.pool.recordTunnel(proxy, opts.Host, connected, downstream, err)
 }
 
-// dialThroughSOCKS5 通过 SOCKS5 代理连接到目标
-func (ps *ProxyServer) dialThroughSOCKS5(proxy *Proxy, target string) (net.Conn, error) {
-	var auth *socks.Auth
-	if proxy.Username != "" && proxy.Password != "" {
-		auth = &socks.Auth{
-			User:     proxy.Username,
-			Password: proxy.Password,
-		}
-	}
-
-	dialer, err := socks.SOCKS5("tcp", fmt.Sprintf("%s:%d", proxy.Address, proxy.Port), auth, &net.Dialer{
-		Timeout:   10 * time.Second,
-		KeepAlive: 30 * time.Second,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create SOCKS5 dialer: %w", err)
-	}
-
-	conn, err := dialer.Dial("tcp", target)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial through SOCKS5: %w", err)
-	}
-
-	return conn, nil
+// dialThroughProxy 按代理类型通过上游代理连接到目标
+func (ps *ProxyServer) dialThroughProxy(proxy *Proxy, target string) (net.Conn, error) {
+	return dialUpstream(context.Background(), proxy, target, 10*time.Second)
 }
@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"log"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 type ProxyServer struct {
 	pool *ProxyPool
+
+	mu            sync.Mutex
+	httpServer    *http.Server
+	socksListener net.Listener
+	conns         connTracker
 }
 
 func NewProxyServer(pool *ProxyPool) *ProxyServer {
@@ -21,8 +30,17 @@ func (ps *ProxyServer) StartHTTPProxy(addr string) {
 	server := &http.Server{
 		Addr: addr,
 		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if ps.pool.config.EnableAuth {
-				if !ps.checkAuth(r) {
+			allowed, trusted := ps.checkClient(false, r.RemoteAddr)
+			if !allowed {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			var user *User
+			if ps.pool.config.EnableAuth && !trusted {
+				var ok bool
+				if user, ok = ps.checkAuth(r); !ok {
+					atomic.AddInt64(&ps.pool.stats.AuthFailures, 1)
 					w.Header().Set("Proxy-Authenticate", "Basic realm=\"Proxy\"")
 					http.Error(w, "Proxy Authentication Required", http.StatusProxyAuthRequired)
 					return
@@ -30,39 +48,65 @@ func (ps *ProxyServer) StartHTTPProxy(addr string) {
 			}
 
 			if r.Method == http.MethodConnect {
-				ps.handleHTTPSConnect(w, r)
+				ps.handleHTTPSConnect(w, r, user)
 			} else {
-				ps.handleHTTP(w, r)
+				ps.handleHTTP(w, r, user)
 			}
 		}),
 	}
 
-	if err := server.ListenAndServe(); err != nil {
+	ps.mu.Lock()
+	ps.httpServer = server
+	ps.mu.Unlock()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
 }
 
-func (ps *ProxyServer) checkAuth(r *http.Request) bool {
+// checkAuth 校验 Proxy-Authorization，返回的 User 为 nil 表示全局账号
+func (ps *ProxyServer) checkAuth(r *http.Request) (*User, bool) {
 	auth := r.Header.Get("Proxy-Authorization")
 	if auth == "" {
-		return false
+		return nil, false
 	}
 
 	const prefix = "Basic "
 	if !strings.HasPrefix(auth, prefix) {
-		return false
+		return nil, false
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(auth[len(prefix):])
 	if err != nil {
-		return false
+		return nil, false
 	}
 
 	credentials := strings.SplitN(string(decoded), ":", 2)
 	if len(credentials) != 2 {
-		return false
+		return nil, false
+	}
+
+	return ps.authenticate(credentials[0], credentials[1])
+}
+
+// authenticate 先匹配全局账号，再匹配入口账号表
+func (ps *ProxyServer) authenticate(username, password string) (*User, bool) {
+	ps.pool.mu.RLock()
+	authUsername := ps.pool.config.AuthUsername
+	authPassword := ps.pool.config.AuthPassword
+	ps.pool.mu.RUnlock()
+
+	if authUsername != "" && username == authUsername && password == authPassword {
+		return nil, true
 	}
 
-	return credentials[0] == ps.pool.config.AuthUsername &&
-		   credentials[1] == ps.pool.config.AuthPassword
+	return ps.pool.users.Authenticate(username, password)
+}
+
+// authorizeDestination 依次检查全局 ACL 和账号允许的目标
+func (ps *ProxyServer) authorizeDestination(ctx context.Context, user *User, host string, port int) error {
+	if err := ps.checkDestination(ctx, host, port); err != nil {
+		return err
+	}
+	return user.allowsDestination(ctx, host)
 }
@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"sync/atomic"
 )
 
 func (ps *ProxyServer) StartSOCKS5Proxy(addr string) {
@@ -16,20 +18,39 @@ func (ps *ProxyServer) StartSOCKS5Proxy(addr string) {
 	}
 	defer listener.Close()
 
+	ps.mu.Lock()
+	ps.socksListener = listener
+	ps.mu.Unlock()
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			log.Printf("Accept error: %v", err)
 			continue
 		}
 
-		go ps.handleSOCKS5(conn)
+		if !ps.conns.add(conn) {
+			conn.Close()
+			continue
+		}
+		go func() {
+			defer ps.conns.done(conn)
+			ps.handleSOCKS5(conn)
+		}()
 	}
 }
 
 func (ps *ProxyServer) handleSOCKS5(conn net.Conn) {
 	defer conn.Close()
 
+	allowed, trusted := ps.checkClient(true, conn.RemoteAddr().String())
+	if !allowed {
+		return
+	}
+
 	// SOCKS5 handshake
 	buf := make([]byte, 256)
 	n, err := conn.Read(buf)
@@ -43,9 +64,12 @@ func (ps *ProxyServer) handleSOCKS5(conn net.Conn) {
 	}
 
 	// Authentication
-	if ps.pool.config.EnableAuth {
+	var user *User
+	if ps.pool.config.EnableAuth && !(trusted && offersNoAuth(buf[:n])) {
 		conn.Write([]byte{0x05, 0x02}) // Username/password auth
-		if !ps.handleSOCKS5Auth(conn) {
+		var ok bool
+		if user, ok = ps.handleSOCKS5Auth(conn, trusted); !ok {
+			atomic.AddInt64(&ps.pool.stats.AuthFailures, 1)
 			return
 		}
 	} else {
@@ -79,5 +103,16 @@ func (ps *ProxyServer) handleSOCKS5(conn net.Conn) {
 		return
 	}
 
-	ps.connectSOCKS5(conn, host, port)
+	ps.connectSOCKS5(conn, host, port, user)
+}
+
+// offersNoAuth 判断客户端握手中是否提供了无认证方式
+func offersNoAuth(greeting []byte) bool {
+	methods := int(greeting[1])
+	for i := 0; i < methods && 2+i < len(greeting); i++ {
+		if greeting[2+i] == 0x00 {
+			return true
+		}
+	}
+	return false
 }
@@ -1,68 +1,99 @@
 package main
 
 import (
-	"fmt"
-	"io"
+	"context"
 	"log"
 	"net"
+	"strconv"
 	"sync/atomic"
+	"time"
 )
 
-func (ps *ProxyServer) handleSOCKS5Auth(conn net.Conn) bool {
+// handleSOCKS5Auth 处理用户名/密码认证，受信任来源只需完成协商
+func (ps *ProxyServer) handleSOCKS5Auth(conn net.Conn, trusted bool) (*User, bool) {
 	buf := make([]byte, 256)
 	n, err := conn.Read(buf)
 	if err != nil || n < 2 {
-		return false
+		return nil, false
 	}
 
 	if buf[0] != 0x01 {
-		return false
+		return nil, false
 	}
 
 	usernameLen := int(buf[1])
 	if n < 2+usernameLen+1 {
-		return false
+		return nil, false
 	}
 
 	username := string(buf[2 : 2+usernameLen])
 	passwordLen := int(buf[2+usernameLen])
+	if n < 3+usernameLen+passwordLen {
+		return nil, false
+	}
 	password := string(buf[3+usernameLen : 3+usernameLen+passwordLen])
 
-	if username == ps.pool.config.AuthUsername && password == ps.pool.config.AuthPassword {
+	if trusted {
+		conn.Write([]byte{0x01, 0x00})
+		return nil, true
+	}
+	if user, ok := ps.authenticate(username, password); ok {
 		conn.Write([]byte{0x01, 0x00})
-		return true
+		return user, true
 	}
 
 	conn.Write([]byte{0x01, 0x01})
-	return false
+	return nil, false
 }
 
-func (ps *ProxyServer) connectSOCKS5(clientConn net.Conn, host string, port uint16) {
-	proxy := ps.pool.GetNextProxy()
+func (ps *ProxyServer) connectSOCKS5(clientConn net.Conn, host string, port uint16, user *User) {
+	if err := ps.authorizeDestination(context.Background(), user, host, int(port)); err != nil {
+		log.Printf("Blocked SOCKS5 connect to %s:%d: %v", host, port, err)
+		clientConn.Write([]byte{0x05, 0x02, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+
+	opts := user.selectOptions()
+	opts.NeedConnect = true
+	opts.Port = int(port)
+	opts.Host = normalizeHost(host)
+	proxy := ps.pool.SelectProxy(opts)
 	if proxy == nil {
 		clientConn.Write([]byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
 		atomic.AddInt64(&ps.pool.stats.FailedRequests, 1)
 		return
 	}
 
+	session, err := ps.beginSession(user)
+	if err != nil {
+		log.Printf("Rejected SOCKS5 connect to %s:%d: %v", host, port, err)
+		clientConn.Write([]byte{0x05, 0x02, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return
+	}
+
 	atomic.AddInt64(&ps.pool.stats.TotalRequests, 1)
 
-	target := fmt.Sprintf("%s:%d", host, port)
-	targetConn, err := net.Dial("tcp", target)
+	target := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	start := time.Now()
+	targetConn, err := ps.dialThroughProxy(proxy, target)
 	if err != nil {
-		log.Printf("Failed to connect to %s: %v", target, err)
 		clientConn.Write([]byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
 		atomic.AddInt64(&proxy.FailCount, 1)
+		ps.pool.recordFailure(proxy, err)
+		ps.pool.recordOutcome(proxy, opts.Host, false, time.Since(start))
 		atomic.AddInt64(&ps.pool.stats.FailedRequests, 1)
 		return
 	}
 	defer targetConn.Close()
+	connected := time.Since(start)
 
 	clientConn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
 
 	atomic.AddInt64(&proxy.SuccessCount, 1)
 	atomic.AddInt64(&ps.pool.stats.SuccessRequests, 1)
 
-	go io.Copy(targetConn, clientConn)
-	io.Copy(clientConn, targetConn)
+	session.proxy = proxy
+	downstream, err := session.tunnel(clientConn, targetConn)
+	ps.pool.inspectTunnel(proxy, opts.Host, downstream, err)
+	ps.pool.recordTunnel(proxy, opts.Host, connected, downstream, err)
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// overDataCap 判断代理本月流量是否已达到上限
+func (proxy *Proxy) overDataCap() bool {
+	return proxy.MonthlyDataCap > 0 && atomic.LoadInt64(&proxy.MonthlyBytes) >= proxy.MonthlyDataCap
+}
+
+// rollProxyUsage 跨月时清零各代理的月流量，达到上限的代理随之恢复轮换
+func (p *ProxyPool) rollProxyUsage() {
+	month := usageMonth(time.Now())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, proxy := range p.proxies {
+		if proxy.UsageMonth != month {
+			proxy.UsageMonth = month
+			atomic.StoreInt64(&proxy.MonthlyBytes, 0)
+			proxy.savedBytes = -1
+		}
+	}
+}
+
+// ResetProxyUsage 手动清零代理的月流量
+func (p *ProxyPool) ResetProxyUsage(id string) (*Proxy, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proxy, ok := p.proxies[id]
+	if !ok {
+		return nil, false
+	}
+	atomic.StoreInt64(&proxy.MonthlyBytes, 0)
+	proxy.UsageMonth = usageMonth(time.Now())
+	proxy.savedBytes = -1
+	return proxy, true
+}
+
+// FlushProxyUsage 将流量有变化的代理写入数据库
+func (p *ProxyPool) FlushProxyUsage() {
+	if p.db == nil {
+		return
+	}
+
+	p.rollProxyUsage()
+
+	p.mu.Lock()
+	pending := make([]Proxy, 0)
+	for _, proxy := range p.proxies {
+		total := atomic.LoadInt64(&proxy.BytesUp) + atomic.LoadInt64(&proxy.BytesDown)
+		if total != proxy.savedBytes {
+			proxy.savedBytes = total
+			snapshot := *proxy
+			snapshot.BytesUp = atomic.LoadInt64(&proxy.BytesUp)
+			snapshot.BytesDown = atomic.LoadInt64(&proxy.BytesDown)
+			snapshot.MonthlyBytes = atomic.LoadInt64(&proxy.MonthlyBytes)
+			pending = append(pending, snapshot)
+		}
+	}
+	p.mu.Unlock()
+
+	for i := range pending {
+		if err := p.db.SaveProxy(&pending[i]); err != nil {
+			log.Printf("Failed to save traffic for proxy %s: %v", pending[i].ID, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+// UserUsage 入口账号在当前日/月周期内的用量
+type UserUsage struct {
+	UserID        string `json:"user_id"`
+	Day           string `json:"day"`
+	DayBytes      int64  `json:"day_bytes"`
+	DayRequests   int64  `json:"day_requests"`
+	Month         string `json:"month"`
+	MonthBytes    int64  `json:"month_bytes"`
+	MonthRequests int64  `json:"month_requests"`
+	dirty         bool
+}
+
+func usageDay(t time.Time) string   { return t.Format("2006-01-02") }
+func usageMonth(t time.Time) string { return t.Format("2006-01") }
+
+// roll 跨日或跨月时清零对应计数
+func (u *UserUsage) roll(now time.Time) {
+	if day := usageDay(now); u.Day != day {
+		u.Day = day
+		u.DayBytes = 0
+		u.DayRequests = 0
+		u.dirty = true
+	}
+	if month := usageMonth(now); u.Month != month {
+		u.Month = month
+		u.MonthBytes = 0
+		u.MonthRequests = 0
+		u.dirty = true
+	}
+}
+
+// quotaError 检查用量是否已达到账号配额
+func (u *UserUsage) quotaError(user *User) error {
+	switch {
+	case user.DailyRequestQuota > 0 && u.DayRequests >= user.DailyRequestQuota:
+		return fmt.Errorf("%w: daily request quota of %d reached", errQuotaExceeded, user.DailyRequestQuota)
+	case user.MonthlyRequestQuota > 0 && u.MonthRequests >= user.MonthlyRequestQuota:
+		return fmt.Errorf("%w: monthly request quota of %d reached", errQuotaExceeded, user.MonthlyRequestQuota)
+	case user.DailyByteQuota > 0 && u.DayBytes >= user.DailyByteQuota:
+		return fmt.Errorf("%w: daily traffic quota of %d bytes reached", errQuotaExceeded, user.DailyByteQuota)
+	case user.MonthlyByteQuota > 0 && u.MonthBytes >= user.MonthlyByteQuota:
+		return fmt.Errorf("%w: monthly traffic quota of %d bytes reached", errQuotaExceeded, user.MonthlyByteQuota)
+	}
+	return nil
+}
+
+// usageLocked 返回账号的用量记录，调用方需持有 usageMu
+func (s *UserStore) usageLocked(userID string) *UserUsage {
+	usage, ok := s.usage[userID]
+	if !ok {
+		usage = &UserUsage{UserID: userID}
+		s.usage[userID] = usage
+	}
+	usage.roll(time.Now())
+	return usage
+}
+
+// Usage 返回账号当前用量的副本
+func (s *UserStore) Usage(userID string) UserUsage {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	return *s.usageLocked(userID)
+}
+
+// startRequest 检查配额并记录一次请求
+func (s *UserStore) startRequest(user *User) error {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	usage := s.usageLocked(user.ID)
+	if err := usage.quotaError(user); err != nil {
+		return err
+	}
+	usage.DayRequests++
+	usage.MonthRequests++
+	usage.dirty = true
+	return nil
+}
+
+// addBytes 记录流量，返回 false 表示流量配额已用尽
+func (s *UserStore) addBytes(user *User, n int64) bool {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	usage := s.usageLocked(user.ID)
+	usage.DayBytes += n
+	usage.MonthBytes += n
+	usage.dirty = true
+
+	if user.DailyByteQuota > 0 && usage.DayBytes >= user.DailyByteQuota {
+		return false
+	}
+	if user.MonthlyByteQuota > 0 && usage.MonthBytes >= user.MonthlyByteQuota {
+		return false
+	}
+	return true
+}
+
+// limiter 返回账号共享的令牌桶，未设置限速时返回 nil
+func (s *UserStore) limiter(user *User) *tokenBucket {
+	if user.BandwidthLimit <= 0 {
+		return nil
+	}
+
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	bucket, ok := s.limiters[user.ID]
+	if !ok || bucket.rate != float64(user.BandwidthLimit) {
+		bucket = newTokenBucket(user.BandwidthLimit)
+		s.limiters[user.ID] = bucket
+	}
+	return bucket
+}
+
+// FlushUsage 将有变化的用量写入数据库
+func (s *UserStore) FlushUsage() {
+	if s.db == nil {
+		return
+	}
+
+	s.usageMu.Lock()
+	pending := make([]UserUsage, 0)
+	for _, usage := range s.usage {
+		if usage.dirty {
+			pending = append(pending, *usage)
+			usage.dirty = false
+		}
+	}
+	s.usageMu.Unlock()
+
+	for i := range pending {
+		if err := s.db.SaveUserUsage(&pending[i]); err != nil {
+			log.Printf("Failed to save usage for user %s: %v", pending[i].UserID, err)
+		}
+	}
+}
+
+// tokenBucket 简单令牌桶，用于限制隧道带宽
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(bytesPerSecond int64) *tokenBucket {
+	burst := float64(bytesPerSecond)
+	if burst < 32*1024 {
+		burst = 32 * 1024
+	}
+	return &tokenBucket{
+		rate:   float64(bytesPerSecond),
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// wait 消耗 n 个令牌，令牌不足时阻塞到可用为止
+func (b *tokenBucket) wait(n int) {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
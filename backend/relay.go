@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+)
+
+// trafficSession 一次入口请求的流量统计与限速
+type trafficSession struct {
+	users   *UserStore
+	user    *User
+	limiter *tokenBucket
+	proxy   *Proxy
+}
+
+// beginSession 检查账号配额并开始一次会话，匿名或全局账号不受配额限制。
+// 会计入一次请求配额，调用方应在选出代理后再调用，没有可用代理时不消耗配额
+func (ps *ProxyServer) beginSession(user *User) (*trafficSession, error) {
+	session := &trafficSession{users: ps.pool.users, user: user}
+	if user == nil {
+		return session, nil
+	}
+
+	if err := ps.pool.users.startRequest(user); err != nil {
+		return nil, err
+	}
+	session.limiter = ps.pool.users.limiter(user)
+	return session, nil
+}
+
+// record 记录传输的字节数，upstream 表示客户端发往目标的方向。
+// 返回 false 表示账号流量配额用尽，应中断传输。
+func (s *trafficSession) record(n int, upstream bool) bool {
+	if s.proxy != nil {
+		if upstream {
+			atomic.AddInt64(&s.proxy.BytesUp, int64(n))
+		} else {
+			atomic.AddInt64(&s.proxy.BytesDown, int64(n))
+		}
+		atomic.AddInt64(&s.proxy.MonthlyBytes, int64(n))
+	}
+
+	if s.user == nil {
+		return true
+	}
+	return s.users.addBytes(s.user, int64(n))
+}
+
+// copy 带限速和计量的 io.Copy，返回转发的字节数和读取 src 时遇到的错误 (含 io.EOF)
+func (s *trafficSession) copy(dst io.Writer, src io.Reader, upstream bool) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var total int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if s.limiter != nil {
+				s.limiter.wait(n)
+			}
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return total, nil
+			}
+			total += int64(n)
+			if !s.record(n, upstream) {
+				return total, errQuotaExceeded
+			}
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// tunnel 双向转发数据，任一方向结束后返回目标发往客户端的字节数和读取目标时的错误
+func (s *trafficSession) tunnel(clientConn, targetConn net.Conn) (int64, error) {
+	go func() {
+		s.copy(targetConn, clientConn, true)
+		targetConn.Close()
+	}()
+	return s.copy(clientConn, targetConn, false)
+}
+
+// meteredBody 统计上传请求体的流量
+type meteredBody struct {
+	io.ReadCloser
+	session *trafficSession
+}
+
+func (b *meteredBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if b.session.limiter != nil {
+			b.session.limiter.wait(n)
+		}
+		if !b.session.record(n, true) {
+			return n, errQuotaExceeded
+		}
+	}
+	return n, err
+}
@@ -1,64 +1,104 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
 	"time"
 )
 
-func (p *ProxyPool) StartHealthCheck() {
-	ticker := time.NewTicker(time.Duration(p.config.CheckInterval) * time.Second)
-	defer ticker.Stop()
+// defaultBackupRetention 默认保留的数据库备份数
+const defaultBackupRetention = 7
 
-	log.Println("Health check started")
-
-	for range ticker.C {
-		p.mu.RLock()
-		interval := p.config.CheckInterval
-		proxies := make([]*Proxy, 0, len(p.proxies))
-		for _, proxy := range p.proxies {
-			proxies = append(proxies, proxy)
-		}
-		p.mu.RUnlock()
+// registerJobs 注册后台任务，调度方式可在配置的 jobs 中修改
+func (p *ProxyPool) registerJobs() {
+	p.jobs.Register("health_check", "Queue proxies and health profiles whose next check is due", "@every 1s", p.dispatchHealthChecks)
+	p.jobs.Register("stats_rollup", "Write user usage, proxy traffic and domain stats to the database", "@every 10s", p.rollupStats)
+	p.jobs.Register("prune_history", "Delete check history and domain stats older than the retention period", "@hourly", p.PruneHistory)
+	p.jobs.Register("backup", "Copy the database to the backups directory", "0 3 * * *", p.BackupDatabase)
+	p.jobs.Register("source_refresh", "Fetch proxy source subscriptions that are due and sync them with the pool", "@every 30s", p.refreshSources)
+}
 
-		log.Printf("Running health check for %d proxies", len(proxies))
+// dispatchHealthChecks 将到期的代理加入验证队列，
+// 各代理的下次检查时间由 scheduleNextCheck 按其状态决定
+func (p *ProxyPool) dispatchHealthChecks() error {
+	now := time.Now()
 
-		for _, proxy := range proxies {
-			go p.validateProxy(proxy)
+	p.mu.RLock()
+	var due []*Proxy
+	profiles := make(map[*Proxy][]string)
+	for _, proxy := range p.proxies {
+		if proxy.Status == StatusActive {
+			if names := p.dueProfiles(proxy, now); len(names) > 0 {
+				profiles[proxy] = names
+			}
+		}
+		if !proxy.NextCheck.IsZero() && proxy.NextCheck.After(now) {
+			continue
 		}
+		if proxy.Status == StatusInactive && !p.config.AutoRefresh {
+			continue
+		}
+		due = append(due, proxy)
+	}
+	p.mu.RUnlock()
 
-		ticker.Reset(time.Duration(interval) * time.Second)
+	for _, proxy := range due {
+		p.validation.Enqueue(proxy, priorityNormal)
+	}
+	for proxy, names := range profiles {
+		for _, name := range names {
+			p.validation.EnqueueProfile(proxy, name)
+		}
 	}
+	return nil
 }
 
-func (p *ProxyPool) StartAutoRefresh() {
-	ticker := time.NewTicker(time.Duration(p.config.RefreshInterval) * time.Second)
-	defer ticker.Stop()
+// rollupStats 将账号用量、代理流量和域名统计写入数据库
+func (p *ProxyPool) rollupStats() error {
+	p.users.FlushUsage()
+	p.FlushProxyUsage()
+	p.FlushDomainStats()
+	return nil
+}
 
-	log.Println("Auto refresh started")
+// BackupDatabase 将数据库复制到数据目录下的 backups，只保留最近的 backup_retention 份
+func (p *ProxyPool) BackupDatabase() error {
+	if p.db == nil {
+		return nil
+	}
 
-	for range ticker.C {
-		p.mu.RLock()
-		autoRefresh := p.config.AutoRefresh
-		interval := p.config.RefreshInterval
-		p.mu.RUnlock()
+	p.mu.RLock()
+	retention := p.config.BackupRetention
+	p.mu.RUnlock()
 
-		if !autoRefresh {
-			ticker.Reset(time.Duration(interval) * time.Second)
-			continue
-		}
+	dir := filepath.Join(filepath.Dir(p.db.path), "backups")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
 
-		log.Println("Running auto refresh")
-		p.mu.RLock()
-		proxies := make([]*Proxy, 0, len(p.proxies))
-		for _, proxy := range p.proxies {
-			proxies = append(proxies, proxy)
-		}
-		p.mu.RUnlock()
+	path := filepath.Join(dir, fmt.Sprintf("proxypoolhub-%s.db", time.Now().Format("20060102-150405")))
+	if err := p.db.Backup(path); err != nil {
+		return err
+	}
+	log.Printf("Database backed up to %s", path)
 
-		for _, proxy := range proxies {
-			go p.validateProxy(proxy)
+	if retention <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(filepath.Join(dir, "proxypoolhub-*.db"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for len(backups) > retention {
+		if err := os.Remove(backups[0]); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
 		}
-
-		ticker.Reset(time.Duration(interval) * time.Second)
+		backups = backups[1:]
 	}
+	return nil
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// SelectOptions 选择代理时的附加条件，零值表示使用全局配置且不做过滤
+type SelectOptions struct {
+	Mode         RotationMode
+	Tags         []string
+	MinAnonymity AnonymityLevel
+	NeedConnect  bool
+	Port         int
+	Host         string
+}
+
+func (p *ProxyPool) GetNextProxy() *Proxy {
+	return p.SelectProxy(SelectOptions{})
+}
+
+// SelectProxy 按条件从可用代理中选出一个
+func (p *ProxyPool) SelectProxy(opts SelectOptions) *Proxy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	minAnonymity := opts.MinAnonymity
+	if minAnonymity == AnonymityUnknown {
+		minAnonymity = p.config.MinAnonymity
+	}
+
+	candidates := make([]*Proxy, 0, len(p.activeProxies))
+	for _, proxy := range p.activeProxies {
+		if proxy.overDataCap() {
+			continue
+		}
+		// 篡改 TLS 的代理不再转发流量
+		if proxy.Untrusted {
+			continue
+		}
+		if len(opts.Tags) > 0 && !proxy.hasAnyTag(opts.Tags) {
+			continue
+		}
+		if proxy.Anonymity.rank() < minAnonymity.rank() {
+			continue
+		}
+		if !proxy.supports(opts) {
+			continue
+		}
+		if !p.healthyFor(proxy, opts.Tags) {
+			continue
+		}
+		if p.bans.banned(proxy.ID, opts.Host) {
+			continue
+		}
+		candidates = append(candidates, proxy)
+	}
+
+	if p.config.CollapseDuplicateExits {
+		candidates = collapseExits(candidates)
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	mode := opts.Mode
+	if mode == "" {
+		mode = p.config.RotationMode
+	}
+
+	switch mode {
+	case Sequential:
+		idx := atomic.AddUint32(&p.currentIndex, 1)
+		return candidates[int(idx)%len(candidates)]
+	case Random:
+		return candidates[rand.Intn(len(candidates))]
+	case LeastUsed:
+		var minProxy *Proxy
+		var minCount int64 = -1
+		for _, proxy := range candidates {
+			count := proxy.SuccessCount + proxy.FailCount
+			if minCount == -1 || count < minCount {
+				minCount = count
+				minProxy = proxy
+			}
+		}
+		return minProxy
+	case Throughput:
+		return selectByThroughput(candidates)
+	case Learned:
+		return p.selectLearned(candidates, opts.Host)
+	}
+
+	return candidates[0]
+}
+
+// hasAnyTag 判断代理是否带有任一指定标签
+func (proxy *Proxy) hasAnyTag(tags []string) bool {
+	for _, want := range tags {
+		for _, tag := range proxy.Tags {
+			if tag == want {
+				return true
+			}
+		}
+	}
+	return false
+}
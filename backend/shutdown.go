@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultShutdownTimeout 关闭时等待连接结束的默认时长 (秒)
+const defaultShutdownTimeout = 30
+
+// connTracker 记录进行中的客户端连接 (SOCKS5 会话和 CONNECT 隧道)，
+// 关闭时等待其结束，超过期限后强制断开
+type connTracker struct {
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	active  sync.WaitGroup
+	closing bool
+}
+
+// add 登记连接，已开始关闭时返回 false
+func (t *connTracker) add(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closing {
+		return false
+	}
+	if t.conns == nil {
+		t.conns = make(map[net.Conn]struct{})
+	}
+	t.conns[conn] = struct{}{}
+	t.active.Add(1)
+	return true
+}
+
+// done 连接结束后注销
+func (t *connTracker) done(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.conns[conn]; ok {
+		delete(t.conns, conn)
+		t.active.Done()
+	}
+}
+
+// drain 拒绝新连接并等待现有连接结束，超过 ctx 期限后强制关闭剩余连接
+func (t *connTracker) drain(ctx context.Context) {
+	t.mu.Lock()
+	t.closing = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.active.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.mu.Lock()
+		log.Printf("Shutdown deadline reached, closing %d connections", len(t.conns))
+		for conn := range t.conns {
+			conn.Close()
+		}
+		t.mu.Unlock()
+	}
+}
+
+// Shutdown 停止在 :8080 和 :1080 上接受新连接，等待进行中的请求和隧道结束，
+// 超过 ctx 期限后强制断开
+func (ps *ProxyServer) Shutdown(ctx context.Context) {
+	ps.mu.Lock()
+	server := ps.httpServer
+	listener := ps.socksListener
+	ps.mu.Unlock()
+
+	if listener != nil {
+		listener.Close()
+	}
+
+	httpDone := make(chan struct{})
+	go func() {
+		defer close(httpDone)
+		if server == nil {
+			return
+		}
+		if err := server.Shutdown(ctx); err != nil {
+			server.Close()
+		}
+	}()
+
+	ps.conns.drain(ctx)
+	<-httpDone
+}
+
+// ShutdownTimeout 关闭时等待连接结束的时长
+func (p *ProxyPool) ShutdownTimeout() time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return time.Duration(p.config.ShutdownTimeout) * time.Second
+}
+
+// Shutdown 等待后台任务和验证结束 (最多到 ctx 期限)，然后将用量、统计和代理状态写入数据库。
+// 调用前应已取消传给 RunJobs 的 ctx。
+func (p *ProxyPool) Shutdown(ctx context.Context) {
+	if err := p.jobs.Wait(ctx); err != nil {
+		log.Printf("Stopped waiting for running jobs: %v", err)
+	}
+	p.validation.Stop(ctx)
+
+	p.rollupStats()
+	p.SaveState()
+}
+
+// SaveState 将全部代理的状态和计数写入数据库
+func (p *ProxyPool) SaveState() {
+	if p.db == nil {
+		return
+	}
+
+	p.mu.RLock()
+	snapshots := make([]Proxy, 0, len(p.proxies))
+	for _, proxy := range p.proxies {
+		snapshot := *proxy
+		snapshot.SuccessCount = atomic.LoadInt64(&proxy.SuccessCount)
+		snapshot.FailCount = atomic.LoadInt64(&proxy.FailCount)
+		snapshot.BytesUp = atomic.LoadInt64(&proxy.BytesUp)
+		snapshot.BytesDown = atomic.LoadInt64(&proxy.BytesDown)
+		snapshot.MonthlyBytes = atomic.LoadInt64(&proxy.MonthlyBytes)
+		snapshots = append(snapshots, snapshot)
+	}
+	p.mu.RUnlock()
+
+	for i := range snapshots {
+		if err := p.db.SaveProxy(&snapshots[i]); err != nil {
+			log.Printf("Failed to save proxy %s: %v", snapshots[i].ID, err)
+		}
+	}
+	log.Printf("Saved state of %d proxies", len(snapshots))
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultSourceInterval 订阅源默认刷新间隔 (秒)
+	defaultSourceInterval = 3600
+	// minSourceInterval 订阅源最短刷新间隔 (秒)
+	minSourceInterval = 60
+)
+
+// Source 代理订阅源，定期拉取列表并与代理池同步。
+// username/password 只用于拉取列表，proxy_username/proxy_password 是列表中代理的默认凭证
+type Source struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	URL             string            `json:"url"`
+	Format          ListFormat        `json:"format"`
+	Enabled         bool              `json:"enabled"`
+	RefreshInterval int               `json:"refresh_interval"`
+	Tags            []string          `json:"tags"`
+	Type            ProxyType         `json:"type,omitempty"`
+	Username        string            `json:"username,omitempty"`
+	Password        string            `json:"password,omitempty"`
+	ProxyUsername   string            `json:"proxy_username,omitempty"`
+	ProxyPassword   string            `json:"proxy_password,omitempty"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	RemoveMissing   bool              `json:"remove_missing"`
+	CreatedAt       time.Time         `json:"created_at"`
+	Stats           SourceStats       `json:"stats"`
+}
+
+// SourceStats 订阅源的拉取统计，fetched/invalid/added/removed 为最近一次成功拉取的结果
+type SourceStats struct {
+	LastFetch   time.Time `json:"last_fetch"`
+	LastSuccess time.Time `json:"last_success"`
+	NextFetch   time.Time `json:"next_fetch"`
+	LastError   string    `json:"last_error,omitempty"`
+	Fetched     int       `json:"fetched"`
+	Invalid     int       `json:"invalid"`
+	Added       int       `json:"added"`
+	Removed     int       `json:"removed"`
+	Proxies     int       `json:"proxies"`
+	Fetches     int64     `json:"fetches"`
+	Failures    int64     `json:"failures"`
+	TotalAdded  int64     `json:"total_added"`
+}
+
+var (
+	errSourceNotFound   = errors.New("source not found")
+	errInvalidSource    = errors.New("invalid source")
+	errSourceRefreshing = errors.New("source is already refreshing")
+)
+
+// SourceStore 管理订阅源，存入 sources 的 Source 不再修改，更新时整体替换
+type SourceStore struct {
+	mu         sync.RWMutex
+	sources    map[string]*Source
+	refreshing map[string]bool
+	db         *Database
+}
+
+func NewSourceStore(db *Database) *SourceStore {
+	return &SourceStore{
+		sources:    make(map[string]*Source),
+		refreshing: make(map[string]bool),
+		db:         db,
+	}
+}
+
+// Load 从数据库加载订阅源
+func (s *SourceStore) Load() error {
+	if s.db == nil {
+		return nil
+	}
+
+	sources, err := s.db.LoadSources()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for _, source := range sources {
+		s.sources[source.ID] = source
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (src *Source) validate() error {
+	u, err := url.Parse(src.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an http or https address", errInvalidSource)
+	}
+	if src.Format == "" {
+		src.Format = FormatText
+	}
+	if !src.Format.valid() {
+		return fmt.Errorf("%w: unsupported format %q", errInvalidSource, src.Format)
+	}
+	if src.Type != "" && !validListType(src.Type) {
+		return fmt.Errorf("%w: unsupported proxy type %q", errInvalidSource, src.Type)
+	}
+	if src.RefreshInterval == 0 {
+		src.RefreshInterval = defaultSourceInterval
+	}
+	if src.RefreshInterval < minSourceInterval {
+		return fmt.Errorf("%w: refresh_interval must be at least %d seconds", errInvalidSource, minSourceInterval)
+	}
+	return nil
+}
+
+// List 返回所有订阅源的副本
+func (s *SourceStore) List() []Source {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sources := make([]Source, 0, len(s.sources))
+	for _, source := range s.sources {
+		sources = append(sources, *source)
+	}
+	return sources
+}
+
+// Get 按 ID 返回订阅源
+func (s *SourceStore) Get(id string) (*Source, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	source, ok := s.sources[id]
+	return source, ok
+}
+
+// Create 创建订阅源，创建后立即到期等待拉取
+func (s *SourceStore) Create(source *Source) error {
+	if source.Name == "" {
+		source.Name = source.URL
+	}
+	if err := source.validate(); err != nil {
+		return err
+	}
+
+	source.ID = uuid.New().String()
+	source.CreatedAt = time.Now()
+	source.Stats = SourceStats{}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.db != nil {
+		if err := s.db.SaveSource(source); err != nil {
+			return err
+		}
+	}
+	s.sources[source.ID] = source
+	return nil
+}
+
+// Update 更新订阅源的设置，保留统计；刷新间隔变化时按新间隔重新安排
+func (s *SourceStore) Update(id string, update *Source) (*Source, error) {
+	if err := update.validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source, ok := s.sources[id]
+	if !ok {
+		return nil, errSourceNotFound
+	}
+
+	updated := *update
+	updated.ID = source.ID
+	updated.CreatedAt = source.CreatedAt
+	updated.Stats = source.Stats
+	if updated.Name == "" {
+		updated.Name = source.Name
+	}
+	if updated.RefreshInterval != source.RefreshInterval && !updated.Stats.LastFetch.IsZero() {
+		updated.Stats.NextFetch = updated.Stats.LastFetch.Add(time.Duration(updated.RefreshInterval) * time.Second)
+	}
+
+	if s.db != nil {
+		if err := s.db.SaveSource(&updated); err != nil {
+			return nil, err
+		}
+	}
+	s.sources[id] = &updated
+	return &updated, nil
+}
+
+// Delete 删除订阅源
+func (s *SourceStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sources[id]; !ok {
+		return errSourceNotFound
+	}
+	if s.db != nil {
+		if err := s.db.DeleteSource(id); err != nil {
+			return err
+		}
+	}
+	delete(s.sources, id)
+	return nil
+}
+
+// Due 返回已启用且到期需要拉取的订阅源
+func (s *SourceStore) Due(now time.Time) []*Source {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var due []*Source
+	for _, source := range s.sources {
+		if source.Enabled && !source.Stats.NextFetch.After(now) {
+			due = append(due, source)
+		}
+	}
+	return due
+}
+
+// begin 标记订阅源正在拉取，同一订阅源不会并发拉取
+func (s *SourceStore) begin(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sources[id]; !ok {
+		return errSourceNotFound
+	}
+	if s.refreshing[id] {
+		return errSourceRefreshing
+	}
+	s.refreshing[id] = true
+	return nil
+}
+
+// finish 保存拉取统计并解除拉取标记，订阅源已被删除时丢弃统计
+func (s *SourceStore) finish(id string, stats SourceStats) (*Source, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.refreshing, id)
+
+	source, ok := s.sources[id]
+	if !ok {
+		return nil, errSourceNotFound
+	}
+	updated := *source
+	updated.Stats = stats
+	if s.db != nil {
+		if err := s.db.SaveSource(&updated); err != nil {
+			return nil, err
+		}
+	}
+	s.sources[id] = &updated
+	return &updated, nil
+}
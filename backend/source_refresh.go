@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxSourceSize 订阅源响应的最大字节数
+	maxSourceSize = 10 << 20
+	// sourceFetchTimeout 拉取订阅源的超时时间
+	sourceFetchTimeout = 30 * time.Second
+)
+
+var errEmptySource = errors.New("source returned no proxies")
+
+// sourceResult 一次同步的结果
+type sourceResult struct {
+	fetched int
+	invalid int
+	added   int
+	removed int
+	owned   int
+}
+
+// fetchSource 拉取订阅源内容
+func fetchSource(ctx context.Context, source *Source) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "ProxyPoolHub")
+	if source.Username != "" {
+		req.SetBasicAuth(source.Username, source.Password)
+	}
+	for name, value := range source.Headers {
+		req.Header.Set(name, value)
+	}
+
+	client := &http.Client{Timeout: sourceFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSourceSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSourceSize {
+		return nil, fmt.Errorf("source is larger than %d bytes", maxSourceSize)
+	}
+	return body, nil
+}
+
+// applyDefaults 为订阅源中的代理补充默认类型、凭证和标签
+func (source *Source) applyDefaults(proxy *Proxy) {
+	proxy.SourceID = source.ID
+	applyListDefaults(proxy, source.Type, source.Tags)
+	if proxy.Username == "" && source.ProxyUsername != "" {
+		proxy.Username = source.ProxyUsername
+		proxy.Password = source.ProxyPassword
+	}
+}
+
+// syncSource 拉取订阅源并与代理池比较：新出现的代理加入并排队验证，
+// 开启 remove_missing 时删除该订阅源添加但已不在列表中的代理。
+// 已存在的同地址代理 (手动添加或来自其他订阅源) 保持不变。
+func (p *ProxyPool) syncSource(source *Source) (sourceResult, error) {
+	var result sourceResult
+
+	body, err := fetchSource(context.Background(), source)
+	if err != nil {
+		return result, err
+	}
+
+	entries, invalid := parseProxyList(body, source.Format)
+	result.fetched = len(entries)
+	result.invalid = len(invalid)
+	// 列表为空多半是源站临时故障，不据此删除代理
+	if len(entries) == 0 {
+		return result, errEmptySource
+	}
+
+	p.mu.RLock()
+	existing := make(map[string]bool, len(p.proxies))
+	var owned []*Proxy
+	for _, proxy := range p.proxies {
+		existing[proxyKey(proxy.Address, proxy.Port)] = true
+		if proxy.SourceID == source.ID {
+			owned = append(owned, proxy)
+		}
+	}
+	p.mu.RUnlock()
+
+	listed := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		key := proxyKey(entry.proxy.Address, entry.proxy.Port)
+		if listed[key] {
+			continue
+		}
+		listed[key] = true
+		if existing[key] {
+			continue
+		}
+
+		proxy := entry.proxy
+		source.applyDefaults(proxy)
+		if err := p.AddProxy(proxy); err != nil {
+			log.Printf("Source %s: failed to add proxy %s: %v", source.Name, key, err)
+			continue
+		}
+		p.validation.Enqueue(proxy, priorityHigh)
+		result.added++
+	}
+
+	result.owned = len(owned) + result.added
+	if source.RemoveMissing {
+		for _, proxy := range owned {
+			if listed[proxyKey(proxy.Address, proxy.Port)] {
+				continue
+			}
+			if err := p.RemoveProxy(proxy.ID); err != nil {
+				log.Printf("Source %s: failed to remove proxy %s:%d: %v", source.Name, proxy.Address, proxy.Port, err)
+				continue
+			}
+			result.removed++
+			result.owned--
+		}
+	}
+	return result, nil
+}
+
+// RefreshSource 立即拉取订阅源并记录统计
+func (p *ProxyPool) RefreshSource(id string) (*Source, error) {
+	if err := p.sources.begin(id); err != nil {
+		return nil, err
+	}
+	source, ok := p.sources.Get(id)
+	if !ok {
+		// 拉取开始前订阅源已被删除
+		p.sources.finish(id, SourceStats{})
+		return nil, errSourceNotFound
+	}
+
+	now := time.Now()
+	stats := source.Stats
+	stats.LastFetch = now
+	stats.NextFetch = now.Add(time.Duration(source.RefreshInterval) * time.Second)
+	stats.Fetches++
+
+	result, err := p.syncSource(source)
+	if err != nil {
+		stats.Failures++
+		stats.LastError = err.Error()
+		log.Printf("Source %s refresh failed: %v", source.Name, err)
+	} else {
+		stats.LastSuccess = now
+		stats.LastError = ""
+		stats.Fetched = result.fetched
+		stats.Invalid = result.invalid
+		stats.Added = result.added
+		stats.Removed = result.removed
+		stats.Proxies = result.owned
+		stats.TotalAdded += int64(result.added)
+		log.Printf("Source %s refreshed: %d listed, %d added, %d removed, %d invalid",
+			source.Name, result.fetched, result.added, result.removed, result.invalid)
+	}
+
+	updated, saveErr := p.sources.finish(id, stats)
+	if err != nil {
+		return updated, err
+	}
+	return updated, saveErr
+}
+
+// refreshSources 拉取所有到期的订阅源
+func (p *ProxyPool) refreshSources() error {
+	due := p.sources.Due(time.Now())
+
+	failed := 0
+	for _, source := range due {
+		_, err := p.RefreshSource(source.ID)
+		if err != nil && !errors.Is(err, errSourceRefreshing) && !errors.Is(err, errSourceNotFound) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d sources failed", failed, len(due))
+	}
+	return nil
+}
+
+// sourceProxyCounts 统计各订阅源当前在代理池中的代理数
+func (p *ProxyPool) sourceProxyCounts() map[string]int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, proxy := range p.proxies {
+		if proxy.SourceID != "" {
+			counts[proxy.SourceID]++
+		}
+	}
+	return counts
+}
+
+// removeSourceProxies 删除订阅源添加的全部代理，返回删除数
+func (p *ProxyPool) removeSourceProxies(sourceID string) (int, error) {
+	p.mu.RLock()
+	var ids []string
+	for _, proxy := range p.proxies {
+		if proxy.SourceID == sourceID {
+			ids = append(ids, proxy.ID)
+		}
+	}
+	p.mu.RUnlock()
+
+	for i, id := range ids {
+		if err := p.RemoveProxy(id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
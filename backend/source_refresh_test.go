@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// listServer 本地代理列表服务，需要 basic auth，可替换内容和状态码
+type listServer struct {
+	mu     sync.Mutex
+	body   string
+	status int
+}
+
+func (s *listServer) set(status int, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.body = status, body
+}
+
+func (s *listServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "feed" || pass != "secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.WriteHeader(s.status)
+	w.Write([]byte(s.body))
+}
+
+func sourceProxies(p *ProxyPool, sourceID string) map[string]*Proxy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	proxies := make(map[string]*Proxy)
+	for _, proxy := range p.proxies {
+		if proxy.SourceID == sourceID {
+			proxies[proxyKey(proxy.Address, proxy.Port)] = proxy
+		}
+	}
+	return proxies
+}
+
+func sortedKeys(m map[string]*Proxy) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRefreshSource(t *testing.T) {
+	list := &listServer{}
+	server := httptest.NewServer(list)
+	defer server.Close()
+
+	p := NewProxyPool()
+	manual := &Proxy{Address: "10.0.0.9", Port: 8080, Type: HTTP}
+	if err := p.AddProxy(manual); err != nil {
+		t.Fatal(err)
+	}
+
+	source := &Source{
+		Name:          "feed",
+		URL:           server.URL + "/list.txt",
+		Enabled:       true,
+		Tags:          []string{"feed"},
+		Type:          SOCKS5,
+		Username:      "feed",
+		Password:      "secret",
+		ProxyUsername: "exit",
+		ProxyPassword: "pass",
+		RemoveMissing: true,
+	}
+	if err := p.sources.Create(source); err != nil {
+		t.Fatal(err)
+	}
+
+	// 首次拉取：新增代理，跳过已存在和重复的条目
+	list.set(http.StatusOK, "# feed\n10.0.0.1:1080\nhttp://10.0.0.2:3128\n10.0.0.9:8080\n10.0.0.1:1080\nnot a proxy\n")
+	updated, err := p.RefreshSource(source.ID)
+	if err != nil {
+		t.Fatalf("first refresh: %v", err)
+	}
+	got := sourceProxies(p, source.ID)
+	if keys := sortedKeys(got); len(keys) != 2 || keys[0] != "10.0.0.1:1080" || keys[1] != "10.0.0.2:3128" {
+		t.Fatalf("proxies after first refresh = %v", keys)
+	}
+	first := got["10.0.0.1:1080"]
+	if first.Type != SOCKS5 || first.Username != "exit" || first.Password != "pass" || !first.hasAnyTag([]string{"feed"}) {
+		t.Errorf("defaults not applied: type=%s user=%q tags=%v", first.Type, first.Username, first.Tags)
+	}
+	if got["10.0.0.2:3128"].Type != HTTP {
+		t.Errorf("listed type overridden: %s", got["10.0.0.2:3128"].Type)
+	}
+	if manual.SourceID != "" {
+		t.Errorf("existing proxy claimed by source")
+	}
+	stats := updated.Stats
+	if stats.Fetched != 4 || stats.Invalid != 1 || stats.Added != 2 || stats.Proxies != 2 || stats.LastError != "" {
+		t.Errorf("first refresh stats = %+v", stats)
+	}
+
+	// 再次拉取：删除从列表消失的代理，保留手动添加的代理
+	list.set(http.StatusOK, "10.0.0.2:3128\n10.0.0.3:1080\n10.0.0.9:8080\n")
+	updated, err = p.RefreshSource(source.ID)
+	if err != nil {
+		t.Fatalf("second refresh: %v", err)
+	}
+	if keys := sortedKeys(sourceProxies(p, source.ID)); len(keys) != 2 || keys[0] != "10.0.0.2:3128" || keys[1] != "10.0.0.3:1080" {
+		t.Fatalf("proxies after second refresh = %v", keys)
+	}
+	if _, ok := p.proxies[manual.ID]; !ok {
+		t.Errorf("manual proxy removed")
+	}
+	if updated.Stats.Added != 1 || updated.Stats.Removed != 1 || updated.Stats.TotalAdded != 3 {
+		t.Errorf("second refresh stats = %+v", updated.Stats)
+	}
+
+	// 拉取失败和空列表都不删除代理
+	for _, tc := range []struct {
+		status int
+		body   string
+	}{
+		{http.StatusInternalServerError, "down"},
+		{http.StatusOK, "# nothing today\n"},
+	} {
+		list.set(tc.status, tc.body)
+		updated, err = p.RefreshSource(source.ID)
+		if err == nil {
+			t.Fatalf("refresh with status %d and body %q succeeded", tc.status, tc.body)
+		}
+		if len(sourceProxies(p, source.ID)) != 2 {
+			t.Errorf("failed refresh removed proxies")
+		}
+	}
+	if updated.Stats.Failures != 2 || updated.Stats.LastError == "" || updated.Stats.Fetches != 4 {
+		t.Errorf("failure stats = %+v", updated.Stats)
+	}
+
+	// 凭证错误时拉取失败
+	bad := *updated
+	bad.Password = "wrong"
+	if _, err := p.sources.Update(source.ID, &bad); err != nil {
+		t.Fatal(err)
+	}
+	list.set(http.StatusOK, "10.0.0.4:1080\n")
+	if _, err := p.RefreshSource(source.ID); err == nil {
+		t.Errorf("refresh with wrong credentials succeeded")
+	}
+}
+
+func TestRefreshSourceNotFound(t *testing.T) {
+	p := NewProxyPool()
+	if _, err := p.RefreshSource("missing"); !errors.Is(err, errSourceNotFound) {
+		t.Errorf("err = %v, want errSourceNotFound", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultThroughputBytes 带宽测试默认下载的字节数
+	defaultThroughputBytes = 1 << 20
+	// maxSpeedTestBytes 测速端点单次最多返回的字节数
+	maxSpeedTestBytes = 100 << 20
+)
+
+var errLowThroughput = errors.New("throughput below minimum")
+
+// speedTestChunk 测速端点重复发送的数据块
+var speedTestChunk = make([]byte, 32*1024)
+
+// SpeedTestHandler 返回指定大小的数据供带宽测试下载，?size= 为字节数
+func (p *ProxyPool) SpeedTestHandler(c *gin.Context) {
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(defaultThroughputBytes)))
+	if err != nil || size < 0 || size > maxSpeedTestBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("size must be between 0 and %d", maxSpeedTestBytes)})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Length", strconv.Itoa(size))
+	c.Status(http.StatusOK)
+
+	for remaining := size; remaining > 0; {
+		n := len(speedTestChunk)
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := c.Writer.Write(speedTestChunk[:n]); err != nil {
+			return
+		}
+		remaining -= n
+	}
+}
+
+// measureThroughput 通过代理下载测试数据，返回收到首字节后的传输速率 (字节/秒)
+func measureThroughput(client *http.Client, url string, maxBytes int64) (int64, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultThroughputBytes
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%w %d from throughput url", errBadStatus, resp.StatusCode)
+	}
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxBytes))
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, fmt.Errorf("throughput url returned no data")
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < time.Millisecond {
+		elapsed = time.Millisecond
+	}
+	return int64(float64(n) / elapsed.Seconds()), nil
+}
+
+// selectByThroughput 按实测带宽加权随机选择，未测速的代理按平均带宽计
+func selectByThroughput(candidates []*Proxy) *Proxy {
+	var total, measured int64
+	for _, proxy := range candidates {
+		if proxy.Throughput > 0 {
+			total += proxy.Throughput
+			measured++
+		}
+	}
+	if measured == 0 {
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	average := total / measured
+	weight := func(proxy *Proxy) int64 {
+		if proxy.Throughput > 0 {
+			return proxy.Throughput
+		}
+		return average
+	}
+
+	total += average * (int64(len(candidates)) - measured)
+	pick := rand.Int63n(total)
+	for _, proxy := range candidates {
+		pick -= weight(proxy)
+		if pick < 0 {
+			return proxy
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// testThroughput 配置了测速地址时测量代理带宽，未达到最低带宽视为检查失败
+func (p *ProxyPool) testThroughput(client *http.Client, result *checkResult) {
+	p.mu.RLock()
+	url := p.config.ThroughputURL
+	maxBytes := p.config.ThroughputBytes
+	minThroughput := p.config.MinThroughput
+	p.mu.RUnlock()
+
+	if url == "" {
+		return
+	}
+
+	throughput, err := measureThroughput(client, url, maxBytes)
+	if err != nil {
+		if minThroughput > 0 {
+			result.Success = false
+			result.Err = fmt.Errorf("throughput test failed: %w", err)
+		}
+		return
+	}
+
+	result.Throughput = throughput
+	if minThroughput > 0 && throughput < minThroughput {
+		result.Success = false
+		result.Err = fmt.Errorf("%w: %d B/s, minimum %d B/s", errLowThroughput, throughput, minThroughput)
+	}
+}
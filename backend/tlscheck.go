@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+var errTLSIntercepted = errors.New("TLS interception detected")
+
+// defaultTLSCheckHost 未配置 tls_check_host 且没有 https 健康检查地址时使用的证书比对主机
+const defaultTLSCheckHost = "www.google.com:443"
+
+// fingerprintState 缓存直连时各主机的证书指纹
+type fingerprintState struct {
+	mu      sync.Mutex
+	entries map[string]fingerprintEntry
+}
+
+type fingerprintEntry struct {
+	fingerprint string
+	checkedAt   time.Time
+}
+
+// tlsCheckTarget 证书比对使用的 host:port，未配置时取第一个 https 健康检查地址，
+// 都没有时使用 defaultTLSCheckHost
+func (c *Config) tlsCheckTarget() string {
+	if c.TLSCheckHost != "" {
+		if _, _, err := net.SplitHostPort(c.TLSCheckHost); err == nil {
+			return c.TLSCheckHost
+		}
+		return net.JoinHostPort(c.TLSCheckHost, "443")
+	}
+
+	targets, _ := c.healthCheckTargets()
+	for _, target := range targets {
+		u, err := url.Parse(target.URL)
+		if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = "443"
+		}
+		return net.JoinHostPort(u.Hostname(), port)
+	}
+	return defaultTLSCheckHost
+}
+
+// handshakeLeaf 在已建立的连接上完成 TLS 握手，返回服务器证书链
+func handshakeLeaf(conn net.Conn, host string, timeout time.Duration) ([]*x509.Certificate, error) {
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate presented by %s", host)
+	}
+	return certs, nil
+}
+
+// certFingerprint 返回证书的 SHA-256 指纹
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// directFingerprint 不经代理连接目标获取证书指纹，结果缓存 10 分钟
+// 拨号期间不持有锁，缓存过期时并发的验证可能各自拨号一次
+func (p *ProxyPool) directFingerprint(target string, timeout time.Duration) (string, error) {
+	p.fingerprints.mu.Lock()
+	entry, ok := p.fingerprints.entries[target]
+	p.fingerprints.mu.Unlock()
+	if ok && time.Since(entry.checkedAt) < 10*time.Minute {
+		return entry.fingerprint, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", target, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	host, _, _ := net.SplitHostPort(target)
+	certs, err := handshakeLeaf(conn, host, timeout)
+	if err != nil {
+		return "", err
+	}
+
+	fingerprint := certFingerprint(certs[0])
+	p.fingerprints.mu.Lock()
+	defer p.fingerprints.mu.Unlock()
+	if p.fingerprints.entries == nil {
+		p.fingerprints.entries = make(map[string]fingerprintEntry)
+	}
+	p.fingerprints.entries[target] = fingerprintEntry{fingerprint: fingerprint, checkedAt: time.Now()}
+	return fingerprint, nil
+}
+
+// detectTLSInterception 比较经代理和直连看到的证书，指纹不同且证书链无法验证时判定代理篡改了 TLS。
+// CDN 可能对不同出口返回不同但合法的证书，因此只有无法验证的证书才视为中间人。
+// verified 表示检查得出了结论：不支持 CONNECT 的代理、直连失败或尚未探测过能力的代理隧道失败时
+// 结果未知，不判定失败，但也不算通过。已知支持 CONNECT 却无法连到检查主机的代理判定为失败，
+// 避免中间人代理只拒绝这一个主机就能通过检查。
+func (p *ProxyPool) detectTLSInterception(proxy *Proxy) (verified bool, err error) {
+	p.mu.RLock()
+	skip := p.config.SkipTLSVerify
+	target := p.config.tlsCheckTarget()
+	timeout := time.Duration(p.config.Timeout) * time.Second
+	capabilities := proxy.Capabilities
+	p.mu.RUnlock()
+
+	if skip {
+		return true, nil
+	}
+	if capabilities != nil && !capabilities.Connect {
+		return false, nil
+	}
+
+	expected, err := p.directFingerprint(target, timeout)
+	if err != nil {
+		log.Printf("TLS interception check skipped, direct connection to %s failed: %v", target, err)
+		return false, nil
+	}
+
+	conn, err := dialUpstream(context.Background(), proxy, target, timeout)
+	if err != nil {
+		if capabilities != nil {
+			return false, fmt.Errorf("TLS check tunnel to %s failed: %w", target, err)
+		}
+		log.Printf("TLS interception check skipped for %s:%d, tunnel to %s failed: %v", proxy.Address, proxy.Port, target, err)
+		return false, nil
+	}
+	defer conn.Close()
+
+	host, _, _ := net.SplitHostPort(target)
+	certs, err := handshakeLeaf(conn, host, timeout)
+	if err != nil {
+		return false, fmt.Errorf("TLS handshake with %s through proxy failed: %w", target, err)
+	}
+	if certFingerprint(certs[0]) == expected {
+		return true, nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates}); err != nil {
+		return false, fmt.Errorf("%w: %s presented certificate issued by %q", errTLSIntercepted, target, certs[0].Issuer.CommonName)
+	}
+	return true, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	socks "golang.org/x/net/proxy"
+)
+
+// addr 返回代理的 host:port
+func (proxy *Proxy) addr() string {
+	return net.JoinHostPort(proxy.Address, strconv.Itoa(proxy.Port))
+}
+
+// dialProxy 连接到上游代理，TLS 代理先完成 TLS 握手
+func dialProxy(ctx context.Context, proxy *Proxy, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", proxy.addr())
+	if err != nil || !proxy.TLS {
+		return conn, err
+	}
+
+	// 代理自身的证书通常为自签名，只用于加密到代理的链路
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         proxy.Address,
+		InsecureSkipVerify: true,
+	})
+	tlsConn.SetDeadline(time.Now().Add(timeout))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with proxy failed: %w", err)
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// dialSOCKS4 通过 SOCKS4/SOCKS4a 代理连接到目标，域名交由代理解析
+func dialSOCKS4(ctx context.Context, proxy *Proxy, target string, timeout time.Duration) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in %q", target)
+	}
+
+	conn, err := dialProxy(ctx, proxy, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	req := []byte{0x04, 0x01, 0, 0}
+	binary.BigEndian.PutUint16(req[2:], uint16(port))
+	ip := net.ParseIP(host).To4()
+	if ip != nil {
+		req = append(req, ip...)
+	} else {
+		req = append(req, 0, 0, 0, 1) // SOCKS4a
+	}
+	req = append(req, []byte(proxy.Username)...)
+	req = append(req, 0)
+	if ip == nil {
+		req = append(req, []byte(host)...)
+		req = append(req, 0)
+	}
+
+	if _, err := conn.Write(req); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send SOCKS4 request: %w", err)
+	}
+
+	reply := make([]byte, 8)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read SOCKS4 reply: %w", err)
+	}
+	if reply[0] != 0x00 || reply[1] != 0x5A {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS4 request rejected (code 0x%02x)", reply[1])
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// dialUpstream 按代理类型通过上游代理建立到目标的隧道
+func dialUpstream(ctx context.Context, proxy *Proxy, target string, timeout time.Duration) (net.Conn, error) {
+	switch proxy.Type {
+	case SOCKS5:
+		return dialSOCKS5(ctx, proxy, target, timeout)
+	case SOCKS4:
+		return dialSOCKS4(ctx, proxy, target, timeout)
+	}
+	return dialHTTPTunnel(ctx, proxy, target, timeout)
+}
+
+// dialHTTPTunnel 通过 HTTP/HTTPS 代理的 CONNECT 连接到目标
+func dialHTTPTunnel(ctx context.Context, proxy *Proxy, target string, timeout time.Duration) (net.Conn, error) {
+	// 连接到代理服务器
+	conn, err := dialProxy(ctx, proxy, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// 发送 CONNECT 请求
+	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", target, target)
+
+	// 如果需要认证
+	if proxy.Username != "" && proxy.Password != "" {
+		auth := proxy.Username + ":" + proxy.Password
+		basicAuth := base64.StdEncoding.EncodeToString([]byte(auth))
+		connectReq += fmt.Sprintf("Proxy-Authorization: Basic %s\r\n", basicAuth)
+	}
+
+	connectReq += "\r\n"
+
+	// 发送请求
+	if _, err := conn.Write([]byte(connectReq)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+
+	// 读取响应
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read CONNECT response: %w", err)
+	}
+
+	response := string(buf[:n])
+	if strings.Contains(response, " 407 ") {
+		conn.Close()
+		return nil, fmt.Errorf("%w for CONNECT to %s", errProxyAuth, target)
+	}
+	if !strings.Contains(response, "200") {
+		conn.Close()
+		return nil, fmt.Errorf("proxy returned non-200 response: %s", response)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// dialSOCKS5 通过 SOCKS5 代理连接到目标
+func dialSOCKS5(ctx context.Context, proxy *Proxy, target string, timeout time.Duration) (net.Conn, error) {
+	var auth *socks.Auth
+	if proxy.Username != "" && proxy.Password != "" {
+		auth = &socks.Auth{
+			User:     proxy.Username,
+			Password: proxy.Password,
+		}
+	}
+
+	dialer, err := socks.SOCKS5("tcp", proxy.addr(), auth, &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SOCKS5 dialer: %w", err)
+	}
+
+	conn, err := dialer.(socks.ContextDialer).DialContext(ctx, "tcp", target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial through SOCKS5: %w", err)
+	}
+
+	return conn, nil
+}
+
+// newUpstreamTransport 创建经由上游 HTTP/SOCKS4 代理转发的 Transport
+func (p *ProxyPool) newUpstreamTransport(proxy *Proxy, timeout time.Duration) *http.Transport {
+	transport := &http.Transport{}
+
+	switch {
+	case proxy.Type == SOCKS4:
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialSOCKS4(ctx, proxy, addr, timeout)
+		}
+	case proxy.TLS:
+		transport.Proxy = http.ProxyURL(p.buildProxyURL(proxy))
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialProxy(ctx, proxy, timeout)
+		}
+	default:
+		transport.Proxy = http.ProxyURL(p.buildProxyURL(proxy))
+	}
+
+	return transport
+}
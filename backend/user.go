@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// User 入口代理账号及其访问策略
+type User struct {
+	ID                  string       `json:"id"`
+	Username            string       `json:"username"`
+	Password            string       `json:"password,omitempty"`
+	PasswordHash        string       `json:"-"`
+	Enabled             bool         `json:"enabled"`
+	AllowedTags         []string     `json:"allowed_tags"`
+	AllowedDestinations []string     `json:"allowed_destinations"`
+	RotationMode        RotationMode `json:"rotation_mode,omitempty"`
+	ExpiresAt           *time.Time   `json:"expires_at,omitempty"`
+	DailyByteQuota      int64        `json:"daily_byte_quota"`
+	MonthlyByteQuota    int64        `json:"monthly_byte_quota"`
+	DailyRequestQuota   int64        `json:"daily_request_quota"`
+	MonthlyRequestQuota int64        `json:"monthly_request_quota"`
+	BandwidthLimit      int64        `json:"bandwidth_limit"`
+	CreatedAt           time.Time    `json:"created_at"`
+}
+
+var (
+	errUserNotFound = errors.New("user not found")
+	errUserExists   = errors.New("username already exists")
+	errInvalidUser  = errors.New("invalid user")
+)
+
+// UserStore 管理入口账号，凭证校验结果缓存以避免每个请求都计算 bcrypt。
+// 存入 users 的 User 不再修改，更新时整体替换。
+type UserStore struct {
+	mu       sync.RWMutex
+	users    map[string]*User
+	verified map[string][sha256.Size]byte
+	db       *Database
+
+	usageMu  sync.Mutex
+	usage    map[string]*UserUsage
+	limiters map[string]*tokenBucket
+}
+
+func NewUserStore(db *Database) *UserStore {
+	return &UserStore{
+		users:    make(map[string]*User),
+		verified: make(map[string][sha256.Size]byte),
+		db:       db,
+		usage:    make(map[string]*UserUsage),
+		limiters: make(map[string]*tokenBucket),
+	}
+}
+
+// Load 从数据库加载账号
+func (s *UserStore) Load() error {
+	if s.db == nil {
+		return nil
+	}
+
+	users, err := s.db.LoadUsers()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for _, user := range users {
+		s.users[user.ID] = user
+	}
+	s.mu.Unlock()
+
+	now := time.Now()
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	for _, user := range users {
+		usage, err := s.db.LoadUserUsage(user.ID, usageDay(now), usageMonth(now))
+		if err != nil {
+			return err
+		}
+		s.usage[user.ID] = usage
+	}
+
+	return nil
+}
+
+// List 返回所有账号的副本，不包含密码哈希
+func (s *UserStore) List() []User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, *user)
+	}
+	return users
+}
+
+// Create 创建账号并保存哈希后的密码
+func (s *UserStore) Create(user *User) error {
+	if user.Username == "" || user.Password == "" {
+		return fmt.Errorf("%w: username and password are required", errInvalidUser)
+	}
+	if err := user.validate(); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.users {
+		if existing.Username == user.Username {
+			return errUserExists
+		}
+	}
+
+	user.ID = uuid.New().String()
+	user.PasswordHash = string(hash)
+	user.Password = ""
+	user.CreatedAt = time.Now()
+
+	if s.db != nil {
+		if err := s.db.SaveUser(user); err != nil {
+			return err
+		}
+	}
+	s.users[user.ID] = user
+	return nil
+}
+
+// Update 更新账号，密码为空时保留原密码
+func (s *UserStore) Update(id string, update *User) (*User, error) {
+	if err := update.validate(); err != nil {
+		return nil, err
+	}
+
+	var hash []byte
+	if update.Password != "" {
+		var err error
+		hash, err = bcrypt.GenerateFromPassword([]byte(update.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[id]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	if update.Username != "" && update.Username != user.Username {
+		for _, existing := range s.users {
+			if existing.Username == update.Username {
+				return nil, errUserExists
+			}
+		}
+	}
+
+	updated := *user
+	if update.Username != "" {
+		updated.Username = update.Username
+	}
+	if hash != nil {
+		updated.PasswordHash = string(hash)
+	}
+	updated.Enabled = update.Enabled
+	updated.AllowedTags = update.AllowedTags
+	updated.AllowedDestinations = update.AllowedDestinations
+	updated.RotationMode = update.RotationMode
+	updated.ExpiresAt = update.ExpiresAt
+	updated.DailyByteQuota = update.DailyByteQuota
+	updated.MonthlyByteQuota = update.MonthlyByteQuota
+	updated.DailyRequestQuota = update.DailyRequestQuota
+	updated.MonthlyRequestQuota = update.MonthlyRequestQuota
+	updated.BandwidthLimit = update.BandwidthLimit
+
+	if s.db != nil {
+		if err := s.db.SaveUser(&updated); err != nil {
+			return nil, err
+		}
+	}
+	s.users[id] = &updated
+	delete(s.verified, id)
+
+	return &updated, nil
+}
+
+// Delete 删除账号
+func (s *UserStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return errUserNotFound
+	}
+	if s.db != nil {
+		if err := s.db.DeleteUser(id); err != nil {
+			return err
+		}
+	}
+	delete(s.users, id)
+	delete(s.verified, id)
+
+	s.usageMu.Lock()
+	delete(s.usage, id)
+	delete(s.limiters, id)
+	s.usageMu.Unlock()
+	return nil
+}
+
+// Get 按 ID 返回账号
+func (s *UserStore) Get(id string) (*User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[id]
+	return user, ok
+}
+
+// Authenticate 校验账号密码，账号被禁用或已过期时认证失败
+func (s *UserStore) Authenticate(username, password string) (*User, bool) {
+	s.mu.RLock()
+	var user *User
+	for _, u := range s.users {
+		if u.Username == username {
+			user = u
+			break
+		}
+	}
+	if user == nil || !user.active() {
+		s.mu.RUnlock()
+		return nil, false
+	}
+	digest := sha256.Sum256([]byte(password))
+	cached, ok := s.verified[user.ID]
+	hash := user.PasswordHash
+	s.mu.RUnlock()
+
+	if ok && subtle.ConstantTimeCompare(cached[:], digest[:]) == 1 {
+		return user, true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	if s.users[user.ID] == user && user.PasswordHash == hash {
+		s.verified[user.ID] = digest
+	}
+	s.mu.Unlock()
+
+	return user, true
+}
+
+// active 判断账号当前是否可用
+func (u *User) active() bool {
+	if !u.Enabled {
+		return false
+	}
+	return u.ExpiresAt == nil || time.Now().Before(*u.ExpiresAt)
+}
+
+func (u *User) validate() error {
+	switch u.RotationMode {
+	case "", Sequential, Random, LeastUsed, Throughput, Learned:
+	default:
+		return fmt.Errorf("%w: rotation mode %q", errInvalidUser, u.RotationMode)
+	}
+	if u.DailyByteQuota < 0 || u.MonthlyByteQuota < 0 || u.DailyRequestQuota < 0 ||
+		u.MonthlyRequestQuota < 0 || u.BandwidthLimit < 0 {
+		return fmt.Errorf("%w: quotas and bandwidth limit must not be negative", errInvalidUser)
+	}
+	for _, entry := range u.AllowedDestinations {
+		if strings.TrimSpace(entry) == "" {
+			return fmt.Errorf("%w: empty destination entry", errInvalidUser)
+		}
+	}
+	return nil
+}
+
+// selectOptions 根据账号策略生成代理选择条件
+func (u *User) selectOptions() SelectOptions {
+	if u == nil {
+		return SelectOptions{}
+	}
+	return SelectOptions{
+		Mode: u.RotationMode,
+		Tags: u.AllowedTags,
+	}
+}
+
+// allowsDestination 检查目标是否在账号允许的域名或网段内，列表为空时不限制
+func (u *User) allowsDestination(ctx context.Context, host string) error {
+	if u == nil || len(u.AllowedDestinations) == 0 {
+		return nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	var domains []string
+	var nets []*net.IPNet
+	for _, entry := range u.AllowedDestinations {
+		if parsed, err := parseCIDRList([]string{entry}); err == nil {
+			nets = append(nets, parsed...)
+		} else {
+			domains = append(domains, entry)
+		}
+	}
+
+	if net.ParseIP(host) == nil && matchDomainList(domains, host) {
+		return nil
+	}
+	if len(nets) > 0 {
+		ips, err := resolveHost(ctx, host)
+		if err == nil {
+			allowed := true
+			for _, ip := range ips {
+				if !matchCIDRList(nets, ip) {
+					allowed = false
+					break
+				}
+			}
+			if allowed {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w: %s not allowed for user %s", errDestinationDenied, host, u.Username)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+type validationPriority int
+
+const (
+	priorityNormal validationPriority = iota
+	priorityHigh
+)
+
+// defaultValidationWorkers 未配置时的验证并发数
+const defaultValidationWorkers = 50
+
+// validationTask 一次验证任务，profile 为空表示全局健康检查
+type validationTask struct {
+	proxy   *Proxy
+	profile string
+}
+
+func (t validationTask) key() string {
+	if t.profile == "" {
+		return t.proxy.ID
+	}
+	return t.proxy.ID + "/" + t.profile
+}
+
+// ValidationQueue 全局验证队列，固定数量的 worker 消费，
+// 已排队或正在验证的任务不会重复入队，新加入的代理优先验证。
+type ValidationQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	high     []validationTask
+	normal   []validationTask
+	pending  map[string]bool
+	workers  int
+	target   int
+	stopped  bool
+	validate func(*Proxy)
+	profile  func(*Proxy, string)
+}
+
+func NewValidationQueue(validate func(*Proxy), profile func(*Proxy, string)) *ValidationQueue {
+	q := &ValidationQueue{
+		pending:  make(map[string]bool),
+		validate: validate,
+		profile:  profile,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Enqueue 加入验证队列，代理已在队列中或正在验证时返回 false
+func (q *ValidationQueue) Enqueue(proxy *Proxy, priority validationPriority) bool {
+	return q.enqueue(validationTask{proxy: proxy}, priority)
+}
+
+// EnqueueProfile 加入一次健康检查方案的检查
+func (q *ValidationQueue) EnqueueProfile(proxy *Proxy, profile string) bool {
+	return q.enqueue(validationTask{proxy: proxy, profile: profile}, priorityNormal)
+}
+
+func (q *ValidationQueue) enqueue(task validationTask, priority validationPriority) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := task.key()
+	if q.stopped || q.pending[key] {
+		return false
+	}
+	q.pending[key] = true
+
+	if priority == priorityHigh {
+		q.high = append(q.high, task)
+	} else {
+		q.normal = append(q.normal, task)
+	}
+	q.cond.Signal()
+	return true
+}
+
+// Len 返回排队和正在执行的验证任务数
+func (q *ValidationQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending)
+}
+
+// SetWorkers 调整 worker 数量，多余的 worker 在完成当前任务后退出
+func (q *ValidationQueue) SetWorkers(n int) {
+	if n <= 0 {
+		n = defaultValidationWorkers
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.stopped {
+		return
+	}
+	q.target = n
+	for q.workers < q.target {
+		q.workers++
+		go q.worker()
+	}
+	q.cond.Broadcast()
+	log.Printf("Validation workers set to %d", n)
+}
+
+func (q *ValidationQueue) worker() {
+	for {
+		task, ok := q.next()
+		if !ok {
+			return
+		}
+
+		if task.profile == "" {
+			q.validate(task.proxy)
+		} else {
+			q.profile(task.proxy, task.profile)
+		}
+
+		q.mu.Lock()
+		delete(q.pending, task.key())
+		q.mu.Unlock()
+	}
+}
+
+// next 取出下一个验证任务，worker 数量超出目标时返回 false
+func (q *ValidationQueue) next() (validationTask, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.workers > q.target {
+			q.workers--
+			q.cond.Broadcast()
+			return validationTask{}, false
+		}
+		if len(q.high) > 0 {
+			task := q.high[0]
+			q.high[0] = validationTask{}
+			q.high = q.high[1:]
+			return task, true
+		}
+		if len(q.normal) > 0 {
+			task := q.normal[0]
+			q.normal[0] = validationTask{}
+			q.normal = q.normal[1:]
+			return task, true
+		}
+		q.cond.Wait()
+	}
+}
+
+// Stop 丢弃排队的任务并等待正在执行的验证结束，超过 ctx 期限后直接返回
+func (q *ValidationQueue) Stop(ctx context.Context) {
+	q.mu.Lock()
+	q.stopped = true
+	q.target = 0
+	for _, task := range q.high {
+		delete(q.pending, task.key())
+	}
+	for _, task := range q.normal {
+		delete(q.pending, task.key())
+	}
+	q.high, q.normal = nil, nil
+	q.cond.Broadcast()
+	running := len(q.pending)
+	q.mu.Unlock()
+
+	if running == 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		q.mu.Lock()
+		for q.workers > 0 {
+			q.cond.Wait()
+		}
+		q.mu.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Stopped waiting for %d running validations", q.Len())
+	}
+}
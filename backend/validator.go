@@ -3,22 +3,44 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"time"
-
-	socks "golang.org/x/net/proxy"
 )
 
+// checkResult 一次代理检查的结果
+type checkResult struct {
+	Success      bool
+	Latency      int64
+	Err          error
+	Anonymity    AnonymityLevel
+	ExitIP       string
+	Capabilities *ProxyCapabilities
+	Throughput   int64
+	TLSVerified  bool
+}
+
 func (p *ProxyPool) validateProxy(proxy *Proxy) {
 	p.mu.Lock()
 	proxy.Status = StatusChecking
 	p.mu.Unlock()
 
-	start := time.Now()
+	// 类型为 auto 时先识别代理协议
+	if proxy.Type == Auto {
+		protocols := p.detectProtocols(proxy)
+		if len(protocols) == 0 {
+			p.markProxyFailed(proxy, errNoProtocol)
+			return
+		}
+		p.mu.Lock()
+		proxy.applyProtocol(protocols)
+		p.mu.Unlock()
+		log.Printf("Proxy %s:%d detected protocols %v", proxy.Address, proxy.Port, protocols)
+	}
 
 	var client *http.Client
 
@@ -34,42 +56,144 @@ func (p *ProxyPool) validateProxy(proxy *Proxy) {
 		return
 	}
 
-	resp, err := client.Get(p.config.HealthCheckURL)
-	responseTime := time.Since(start).Milliseconds()
+	result := p.runChecks(client)
+	if result.Success {
+		p.testThroughput(client, &result)
+	}
+	if result.Success {
+		verified, err := p.detectTLSInterception(proxy)
+		if err != nil {
+			result.Success = false
+			result.Err = err
+		}
+		result.TLSVerified = verified
+	}
+	if result.Success {
+		result.Anonymity, result.ExitIP = p.detectExit(proxy, client)
+		result.Capabilities = p.probeCapabilities(proxy)
+	}
+
+	p.applyCheckResult(proxy, result)
+	p.recordCheck(proxy, result)
+}
+
+// detectExit 检测代理的匿名度和出口 IP，配置了判定地址时优先使用判定结果
+func (p *ProxyPool) detectExit(proxy *Proxy, client *http.Client) (AnonymityLevel, string) {
+	anonymity, judged, err := p.detectAnonymity(client)
+	if err != nil {
+		log.Printf("Proxy %s:%d anonymity check failed: %v", proxy.Address, proxy.Port, err)
+	}
+	if judged != nil {
+		return anonymity, judged.IP
+	}
+
+	p.mu.RLock()
+	echoURL := p.config.IPEchoURL
+	p.mu.RUnlock()
+
+	if echoURL == "" {
+		return anonymity, ""
+	}
+	exitIP, err := detectExitIP(client, echoURL)
+	if err != nil {
+		log.Printf("Proxy %s:%d exit IP detection failed: %v", proxy.Address, proxy.Port, err)
+	}
+	return anonymity, exitIP
+}
+
+// runChecks 使用全局健康检查目标检查代理
+func (p *ProxyPool) runChecks(client *http.Client) checkResult {
+	p.mu.RLock()
+	targets, quorum := p.config.healthCheckTargets()
+	p.mu.RUnlock()
+
+	return runTargets(client, targets, quorum)
+}
 
+// runTargets 依次请求所有检查目标，通过数达到法定数即视为成功
+func runTargets(client *http.Client, targets []HealthCheckTarget, quorum int) checkResult {
+	var result checkResult
+	var passed int
+	var totalLatency int64
+	for i := range targets {
+		latency, err := targets[i].run(context.Background(), client)
+		if err != nil {
+			if result.Err == nil {
+				result.Err = err
+			}
+			continue
+		}
+		passed++
+		totalLatency += latency
+	}
+
+	if passed > 0 {
+		result.Latency = totalLatency / int64(passed)
+	}
+	result.Success = passed >= quorum
+	if result.Success {
+		result.Err = nil
+	} else if result.Err == nil {
+		result.Err = fmt.Errorf("only %d of %d health checks passed", passed, quorum)
+	}
+	return result
+}
+
+// applyCheckResult 根据检查结果更新代理状态
+func (p *ProxyPool) applyCheckResult(proxy *Proxy, result checkResult) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	proxy.LastCheck = time.Now()
-	proxy.ResponseTime = responseTime
+	proxy.ResponseTime = result.Latency
+	if result.Throughput > 0 {
+		proxy.Throughput = result.Throughput
+	}
 
-	if err != nil || resp == nil || resp.StatusCode >= 400 {
+	if !result.Success {
 		proxy.FailCount++
 		if proxy.FailCount >= int64(p.config.MaxFailCount) {
 			proxy.Status = StatusInactive
 		}
-		log.Printf("Proxy %s:%d validation failed: %v", proxy.Address, proxy.Port, err)
+		proxy.setLastError(result.Err)
+		if errors.Is(result.Err, errTLSIntercepted) {
+			proxy.Untrusted = true
+		}
+		log.Printf("Proxy %s:%d validation failed (%s): %v", proxy.Address, proxy.Port, proxy.LastErrorClass, result.Err)
 	} else {
 		proxy.SuccessCount++
 		proxy.Status = StatusActive
 		proxy.FailCount = 0
-		resp.Body.Close()
+		proxy.clearLastError()
+		// 证书检查没有结论时保留之前的判定
+		if result.TLSVerified {
+			proxy.Untrusted = false
+		}
+		if result.Anonymity != AnonymityUnknown {
+			proxy.Anonymity = result.Anonymity
+		}
+		if result.ExitIP != "" {
+			proxy.ExitIP = result.ExitIP
+		}
+		if result.Capabilities != nil {
+			proxy.Capabilities = result.Capabilities
+		}
 	}
 
+	p.scheduleNextCheck(proxy, result.Success)
 	p.rebuildActiveProxies()
 }
 
 func (p *ProxyPool) createHTTPClient(proxy *Proxy) *http.Client {
-	proxyURL := p.buildProxyURL(proxy)
+	timeout := time.Duration(p.config.Timeout) * time.Second
+	transport := p.newUpstreamTransport(proxy, timeout)
+	transport.TLSClientConfig = &tls.Config{
+		InsecureSkipVerify: p.config.SkipTLSVerify,
+	}
 
 	return &http.Client{
-		Timeout: time.Duration(p.config.Timeout) * time.Second,
-		Transport: &http.Transport{
-			Proxy: http.ProxyURL(proxyURL),
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
-			},
-		},
+		Timeout:   timeout,
+		Transport: transport,
 	}
 }
 
@@ -92,45 +216,24 @@ func (p *ProxyPool) buildProxyURL(proxy *Proxy) *url.URL {
 }
 
 func (p *ProxyPool) createSOCKS5Client(proxy *Proxy) *http.Client {
-	// 创建 SOCKS5 拨号器
-	var auth *socks.Auth
-	if proxy.Username != "" && proxy.Password != "" {
-		auth = &socks.Auth{
-			User:     proxy.Username,
-			Password: proxy.Password,
-		}
-	}
-
-	dialer, err := socks.SOCKS5("tcp", fmt.Sprintf("%s:%d", proxy.Address, proxy.Port), auth, &net.Dialer{
-		Timeout:   time.Duration(p.config.Timeout) * time.Second,
-		KeepAlive: 30 * time.Second,
-	})
-	if err != nil {
-		log.Printf("Failed to create SOCKS5 dialer: %v", err)
-		return nil
-	}
+	timeout := time.Duration(p.config.Timeout) * time.Second
 
 	return &http.Client{
-		Timeout: time.Duration(p.config.Timeout) * time.Second,
+		Timeout: timeout,
 		Transport: &http.Transport{
 			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-				return dialer.Dial(network, addr)
+				return dialSOCKS5(ctx, proxy, addr, timeout)
 			},
 			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
+				InsecureSkipVerify: p.config.SkipTLSVerify,
 			},
 		},
 	}
 }
-func (p *ProxyPool) markProxyFailed(proxy *Proxy, err error) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
 
-	proxy.LastCheck = time.Now()
-	proxy.FailCount++
-	if proxy.FailCount >= int64(p.config.MaxFailCount) {
-		proxy.Status = StatusInactive
-	}
-	log.Printf("Proxy %s:%d failed: %v", proxy.Address, proxy.Port, err)
-	p.rebuildActiveProxies()
+// markProxyFailed 记录一次未能完成检查的失败
+func (p *ProxyPool) markProxyFailed(proxy *Proxy, err error) {
+	result := checkResult{Err: err}
+	p.applyCheckResult(proxy, result)
+	p.recordCheck(proxy, result)
 }
@@ -1,5 +1,5 @@
 import axios from 'axios';
-import type { Proxy, Config, Stats } from './types';
+import type { Proxy, Config, Stats, ListFormat, ImportResult, ExportOptions } from './types';
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || '/api';
 
@@ -31,6 +31,16 @@ export const proxyApi = {
     return response.data;
   },
 
+  importProxyList: async (data: string, format: ListFormat = 'auto') => {
+    const response = await api.post<ImportResult>('/proxies/import', { data, format });
+    return response.data;
+  },
+
+  exportProxies: async (options: ExportOptions = {}) => {
+    const response = await api.get<string>('/proxies/export', { params: options, responseType: 'text' });
+    return response.data;
+  },
+
   validateProxies: async () => {
     const response = await api.post('/proxies/validate');
     return response.data;
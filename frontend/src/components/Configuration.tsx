@@ -41,6 +41,8 @@ export default function Configuration({ config, onUpdate }: ConfigurationProps)
                 <option value="sequential">顺序</option>
                 <option value="random">随机</option>
                 <option value="least_used">最少使用</option>
+                <option value="throughput">按带宽加权</option>
+                <option value="learned">按域名成功率学习</option>
               </select>
             </div>
 
@@ -1,6 +1,20 @@
-export type ProxyType = 'http' | 'https' | 'socks5';
+export type ProxyType = 'http' | 'https' | 'socks5' | 'socks4' | 'auto';
 export type ProxyStatus = 'active' | 'inactive' | 'checking';
-export type RotationMode = 'sequential' | 'random' | 'least_used';
+export type AnonymityLevel = '' | 'transparent' | 'anonymous' | 'elite';
+export type ErrorClass =
+  | ''
+  | 'dns'
+  | 'refused'
+  | 'timeout'
+  | 'tls'
+  | 'tls_intercepted'
+  | 'proxy_auth'
+  | 'bad_status'
+  | 'body_assertion'
+  | 'too_slow'
+  | 'protocol'
+  | 'other';
+export type RotationMode = 'sequential' | 'random' | 'least_used' | 'throughput' | 'learned';
 
 export interface Proxy {
   id: string;
@@ -15,6 +29,115 @@ export interface Proxy {
   fail_count: number;
   last_check: string;
   created_at: string;
+  tags?: string[] | null;
+  bytes_up?: number;
+  bytes_down?: number;
+  monthly_bytes?: number;
+  usage_month?: string;
+  monthly_data_cap?: number;
+  anonymity?: AnonymityLevel;
+  exit_ip?: string;
+  protocols?: ProxyType[] | null;
+  tls?: boolean;
+  capabilities?: ProxyCapabilities;
+  last_error_class?: ErrorClass;
+  last_error?: string;
+  last_error_at?: string;
+  next_check?: string;
+  throughput?: number;
+  untrusted?: boolean;
+  profile_health?: Record<string, ProfileHealth>;
+  source_id?: string;
+  country: string;
+}
+
+export interface ProfileHealth {
+  status: ProxyStatus;
+  response_time: number;
+  fail_count: number;
+  last_check: string;
+  next_check: string;
+  last_error?: string;
+}
+
+export interface ProxyCapabilities {
+  connect: boolean;
+  ports: number[] | null;
+  blocked_ports: number[] | null;
+  udp: boolean;
+  http2: boolean;
+  checked_at: string;
+}
+
+export interface CheckRecord {
+  checked_at: string;
+  success: boolean;
+  latency: number;
+  error_class?: ErrorClass;
+  error?: string;
+  exit_ip?: string;
+}
+
+export interface ProxyHistory {
+  proxy_id: string;
+  window: string;
+  summary: {
+    checks: number;
+    successes: number;
+    uptime: number;
+    latency_p50: number;
+    latency_p90: number;
+    latency_p95: number;
+    latency_p99: number;
+  };
+  checks: CheckRecord[] | null;
+}
+
+export interface TestReport {
+  proxy: string;
+  type: ProxyType;
+  target: string;
+  success: boolean;
+  status_code: number;
+  timings: {
+    dns: number;
+    connect: number;
+    proxy_handshake: number;
+    tls: number;
+    ttfb: number;
+    total: number;
+  };
+  exit_ip: string;
+  anonymity: AnonymityLevel;
+  error_class?: ErrorClass;
+  error?: string;
+}
+
+export interface User {
+  id: string;
+  username: string;
+  password?: string;
+  enabled: boolean;
+  allowed_tags: string[] | null;
+  allowed_destinations: string[] | null;
+  rotation_mode?: RotationMode;
+  expires_at?: string;
+  daily_byte_quota: number;
+  monthly_byte_quota: number;
+  daily_request_quota: number;
+  monthly_request_quota: number;
+  bandwidth_limit: number;
+  created_at: string;
+}
+
+export interface UserUsage {
+  user_id: string;
+  day: string;
+  day_bytes: number;
+  day_requests: number;
+  month: string;
+  month_bytes: number;
+  month_requests: number;
 }
 
 export interface Config {
@@ -28,6 +151,198 @@ export interface Config {
   auth_password: string;
   auto_refresh: boolean;
   refresh_interval: number;
+  destination_acl: DestinationACL;
+  http_client_acl: ClientACL;
+  socks5_client_acl: ClientACL;
+  judge_url: string;
+  min_anonymity: AnonymityLevel;
+  health_checks: HealthCheckTarget[] | null;
+  health_check_quorum: number;
+  validation_workers: number;
+  ip_echo_url: string;
+  collapse_duplicate_exits: boolean;
+  capability_ports: number[] | null;
+  capability_host: string;
+  history_retention_days: number;
+  throughput_url: string;
+  throughput_bytes: number;
+  min_throughput: number;
+  skip_tls_verify: boolean;
+  tls_check_host: string;
+  health_profiles: HealthCheckProfile[] | null;
+  ban_rules: BanRule[] | null;
+  jobs: JobSetting[] | null;
+  backup_retention: number;
+  shutdown_timeout: number;
+}
+
+export interface HealthCheckTarget {
+  url: string;
+  method?: string;
+  headers?: Record<string, string>;
+  expected_status?: number[];
+  body_contains?: string;
+  body_regex?: string;
+  max_latency?: number;
+}
+
+export interface HealthCheckProfile {
+  name: string;
+  tags: string[] | null;
+  targets: HealthCheckTarget[];
+  quorum: number;
+  interval: number;
+}
+
+export interface BanRule {
+  name: string;
+  domains: string[] | null;
+  status_codes: number[] | null;
+  header_patterns: Record<string, string> | null;
+  body_patterns: string[] | null;
+  connect_reset: boolean;
+  cooldown: number;
+}
+
+export interface DomainStat {
+  proxy_id: string;
+  domain: string;
+  requests: number;
+  successes: number;
+  failures: number;
+  success_rate: number;
+  score: number;
+  avg_latency: number;
+  last_success: string;
+  last_failure: string;
+  updated_at: string;
+}
+
+export interface DomainSummary {
+  domain: string;
+  requests: number;
+  successes: number;
+  success_rate: number;
+  proxies: number;
+  best_proxy: string;
+  updated_at: string;
+}
+
+export interface DomainBan {
+  proxy_id: string;
+  domain: string;
+  rule: string;
+  until: string;
+}
+
+export interface JobSetting {
+  name: string;
+  schedule: string;
+  paused: boolean;
+}
+
+export interface JobRun {
+  started_at: string;
+  duration: number;
+  trigger: 'schedule' | 'manual';
+  error?: string;
+}
+
+export interface JobStatus {
+  name: string;
+  description: string;
+  schedule: string;
+  default_schedule: string;
+  paused: boolean;
+  running: boolean;
+  next_run: string;
+  last_run: string;
+  last_duration: number;
+  avg_duration: number;
+  last_error?: string;
+  runs: number;
+  failures: number;
+}
+
+export type ListFormat = 'auto' | 'text' | 'json' | 'csv' | 'clash' | 'base64';
+
+export type ExportFormat = 'txt' | 'csv' | 'json' | 'clash' | 'curl' | 'env';
+
+export interface ExportOptions {
+  format?: ExportFormat;
+  status?: ProxyStatus | 'all';
+  tags?: string;
+  country?: string;
+  max_latency?: number;
+  credentials?: boolean;
+  url?: string;
+}
+
+export interface ImportReportLine {
+  line: number;
+  input: string;
+  status: 'added' | 'duplicate' | 'rejected';
+  error?: string;
+  id?: string;
+}
+
+export interface ImportResult {
+  message: string;
+  format: ListFormat;
+  added: number;
+  duplicates: number;
+  rejected: number;
+  report: ImportReportLine[];
+}
+
+export interface SourceStats {
+  last_fetch: string;
+  last_success: string;
+  next_fetch: string;
+  last_error?: string;
+  fetched: number;
+  invalid: number;
+  added: number;
+  removed: number;
+  proxies: number;
+  fetches: number;
+  failures: number;
+  total_added: number;
+}
+
+export interface Source {
+  id: string;
+  name: string;
+  url: string;
+  format: ListFormat;
+  enabled: boolean;
+  refresh_interval: number;
+  tags: string[];
+  type?: ProxyType;
+  username?: string;
+  password?: string;
+  proxy_username?: string;
+  proxy_password?: string;
+  headers?: Record<string, string>;
+  remove_missing: boolean;
+  created_at: string;
+  stats: SourceStats;
+}
+
+export interface ClientACL {
+  allowed_cidrs: string[] | null;
+  trusted_cidrs: string[] | null;
+}
+
+export interface DestinationACL {
+  enabled: boolean;
+  default_deny: boolean;
+  allow_cidrs: string[] | null;
+  deny_cidrs: string[] | null;
+  allow_domains: string[] | null;
+  deny_domains: string[] | null;
+  allow_ports: number[] | null;
+  deny_ports: number[] | null;
 }
 
 export interface Stats {
@@ -36,4 +351,7 @@ export interface Stats {
   total_requests: number;
   success_requests: number;
   failed_requests: number;
+  rejected_clients: number;
+  auth_failures: number;
+  validation_queue: number;
 }